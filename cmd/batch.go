@@ -0,0 +1,253 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// imageExtensions are the file extensions that are read from directories.
+// Files named with --infile or as arguments are read whatever their extension.
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".bmp", ".pbm", ".pgm", ".ppm", ".pnm", ".tif", ".tiff", ".fits", ".fit", ".fts"}
+
+var recursive bool
+var jobs int
+var pageNumber int
+var allPages bool
+
+// batch is true when a command is reading more than one file
+var batch bool
+
+// inputFiles returns the files named by --infile and the arguments,
+// after expanding globs and directories
+func inputFiles(args []string) ([]string, error) {
+	names := append(append([]string(nil), infiles...), args...)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one --infile or file argument is required")
+	}
+	if pageNumber < 1 {
+		return nil, fmt.Errorf("--page must be 1 or more")
+	}
+	if allPages && pageNumber != 1 {
+		return nil, fmt.Errorf("--page and --all-pages can't be used together")
+	}
+
+	var files []string
+	for _, name := range names {
+		matches := []string{name}
+		if strings.ContainsAny(name, "*?[") {
+			var err error
+			matches, err = filepath.Glob(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", name)
+			}
+		}
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil || !fi.IsDir() {
+				// a missing file is reported when it is read, along with any other per-file errors
+				files = append(files, match)
+				continue
+			}
+			found, err := directoryFiles(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, found...)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no image files found in %s", strings.Join(names, ", "))
+	}
+	batch = len(files) > 1 || allPages
+	return files, nil
+}
+
+// oneInputFile returns the file named by --infile or the arguments,
+// for commands that only read a single file
+func oneInputFile(args []string) (string, error) {
+	files, err := inputFiles(args)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 1 {
+		return "", fmt.Errorf("only one input file can be used, but %d were given", len(files))
+	}
+	return files[0], nil
+}
+
+// directoryFiles returns the image files in dir, and in its subdirectories with --recursive
+func directoryFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// analyzeFiles calls fn for each file, using up to --jobs goroutines at a time,
+// and writes the reports in the same order as the files after grouping them into one.
+// A file that fails is logged without stopping the others, and the command exits with
+// a status of 1 at the end.
+func analyzeFiles(files []string, group func([]report) report, fn func(file string) ([]report, error)) {
+	type result struct {
+		reports []report
+		err     error
+	}
+	results := make([]result, len(files))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				reports, err := fn(files[i])
+				results[i] = result{reports, err}
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var reports []report
+	failed := 0
+	for i, res := range results {
+		if res.err != nil {
+			log.Printf("%s: %v", files[i], res.err)
+			failed++
+			continue
+		}
+		reports = append(reports, res.reports...)
+	}
+
+	if len(reports) > 0 {
+		if err := writeReport(group(reports)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if failed > 0 {
+		log.Printf("%d of %d files couldn't be read", failed, len(files))
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// eachPage returns a function for analyzeFiles that reads the pages of a file chosen by --page
+// or --all-pages, and calls fn for each of them. With --all-pages, the pages of a multi-page
+// file are named with their page number, eg: scan.tif[2]
+func eachPage(fn func(name string, m image.Image, format string) ([]report, error)) func(file string) ([]report, error) {
+	return func(file string) ([]report, error) {
+		var pages []int
+		if !allPages {
+			pages = []int{pageNumber - 1}
+		}
+		images, format, n, err := readPages(file, pages)
+		if err != nil {
+			return nil, err
+		}
+		var reports []report
+		for i, m := range images {
+			name := file
+			if allPages && n > 1 {
+				name = fmt.Sprintf("%s[%d]", file, i+1)
+			}
+			r, err := fn(name, m, format)
+			if err != nil {
+				return nil, err
+			}
+			reports = append(reports, r...)
+		}
+		return reports, nil
+	}
+}
+
+// a summarizer is a report that can be shown as one row of a fileTable
+type summarizer interface {
+	// summary returns the table header and a row of short, human-readable values
+	summary() (header []string, row []string)
+}
+
+// fileTable shows a list of reports as a single table, with one row per report.
+// It is used for the table output of commands that read many files.
+type fileTable struct {
+	reportList
+	title string
+}
+
+// fileTableOf returns a function that groups reports into a fileTable with the given title
+// when several files are being read. The reports must be summarizers.
+func fileTableOf(title string) func([]report) report {
+	return func(reports []report) report {
+		if !batch {
+			return combine(reports)
+		}
+		return fileTable{reportList(reports), title}
+	}
+}
+
+func (t fileTable) table() string {
+	var rows [][]string
+	for i, r := range t.reportList {
+		header, row := r.(summarizer).summary()
+		if i == 0 {
+			rows = append(rows, header)
+		}
+		rows = append(rows, row)
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("# %s\n\n", t.title))
+	for i, row := range rows {
+		out.WriteString("|" + strings.Join(row, "|") + "|\n")
+		if i == 0 {
+			out.WriteString(strings.Repeat("|:-----", len(row)) + "|\n")
+		}
+	}
+	return renderMarkdown(out.String())
+}
@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var castBands int
+var castThreshold float64
+
+// castCmd represents the cast command
+var castCmd = &cobra.Command{
+	Use:   "cast",
+	Short: "show the color cast of a near-greyscale image",
+	Long: `
+The 'show cast' command estimates the tint of an image that should be
+greyscale, like a scan of a yellowed page or a sepia-toned print.
+
+The cast is shown as the average a* and b* offset from neutral grey in
+CIE Lab, along with its strength (chroma) and hue angle. The pixels are
+also split into --bands tonal bands by lightness, to show whether the
+tint changes from the shadows to the highlights:
+
+  neutral  no band has a chroma of at least --threshold
+  uniform  every tone has about the same tint
+  graded   the tint has one hue, but its strength changes (eg: sepia)
+  split    the shadows and highlights have different hues
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		file, err := oneInputFile(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if allPages {
+			log.Fatal("show cast reads a single page, so use --page instead of --all-pages")
+		}
+		images, _, _, err := readPages(file, []int{pageNumber - 1})
+		if err != nil {
+			log.Fatal(err)
+		}
+		m := images[0]
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		regions, err := selections()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var reports []report
+		for _, sel := range regions {
+			analyzer.Region = sel.region
+			result, err := analyzer.Cast(m, castBands)
+			if err != nil {
+				log.Fatal(err)
+			}
+			reports = append(reports, newCastReport(file, sel.label, result))
+		}
+
+		err = writeReport(combine(reports))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// castReport is the output of the cast command
+type castReport struct {
+	File       string `json:"file" yaml:"file"`
+	Region     string `json:"region" yaml:"region"`
+	Toning     string `json:"toning" yaml:"toning"`
+	castValues `yaml:",inline"`
+	Bands      []castBand `json:"bands" yaml:"bands"`
+}
+
+// castValues describes the cast of some pixels
+type castValues struct {
+	Pixels  int     `json:"pixels" yaml:"pixels"`
+	A       float64 `json:"a" yaml:"a"`
+	B       float64 `json:"b" yaml:"b"`
+	Chroma  float64 `json:"chroma" yaml:"chroma"`
+	Hue     float64 `json:"hue" yaml:"hue"`
+	HueName string  `json:"hue_name" yaml:"hue_name"`
+}
+
+// castBand is the cast of one tonal band
+type castBand struct {
+	MinL       float64 `json:"min_l" yaml:"min_l"`
+	MaxL       float64 `json:"max_l" yaml:"max_l"`
+	castValues `yaml:",inline"`
+}
+
+func newCastValues(c greyscale.ColorCast) castValues {
+	return castValues{c.Pixels, c.A, c.B, c.Chroma(), c.Hue(), greyscale.HueName(c.Hue())}
+}
+
+// newCastReport makes a report from the color cast of a region
+func newCastReport(file, region string, res *greyscale.CastResult) castReport {
+	r := castReport{
+		File:       file,
+		Region:     region,
+		Toning:     res.Toning(castThreshold),
+		castValues: newCastValues(res.ColorCast),
+	}
+	for _, b := range res.Bands {
+		r.Bands = append(r.Bands, castBand{b.MinL, b.MaxL, newCastValues(b.ColorCast)})
+	}
+	return r
+}
+
+func (r castReport) kind() string { return "cast" }
+
+func (r castReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Color Cast\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|a\\*|%.02f|\n", r.A))
+	out.WriteString(fmt.Sprintf("|b\\*|%.02f|\n", r.B))
+	out.WriteString(fmt.Sprintf("|Chroma|%.02f|\n", r.Chroma))
+	out.WriteString(fmt.Sprintf("|Hue|%.01f° (%s)|\n", r.Hue, r.HueName))
+	out.WriteString(fmt.Sprintf("|Toning|%s|\n\n", r.Toning))
+	out.WriteString("## Tonal Bands\n\n")
+	out.WriteString("|Lightness|Pixels|a\\*|b\\*|Chroma|Hue|\n")
+	out.WriteString("|:--:|----:|----:|----:|----:|:----|\n")
+	for _, b := range r.Bands {
+		if b.Pixels == 0 {
+			out.WriteString(fmt.Sprintf("|%.0f-%.0f|0|||||\n", b.MinL, b.MaxL))
+			continue
+		}
+		out.WriteString(fmt.Sprintf("|%.0f-%.0f|%d|%.02f|%.02f|%.02f|%.01f° (%s)|\n", b.MinL, b.MaxL, b.Pixels, b.A, b.B, b.Chroma, b.Hue, b.HueName))
+	}
+	out.WriteString(fmt.Sprintf("\n*Pixels considered: %d*\n", r.Pixels))
+	if r.Region != "all" {
+		out.WriteString(fmt.Sprintf("\n*Region: %s*\n", r.Region))
+	}
+	return renderMarkdown(out.String())
+}
+
+func (r castReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	row := func(band string, minL, maxL float64, v castValues) []string {
+		return []string{r.File, r.Region, band, f(minL), f(maxL), strconv.Itoa(v.Pixels), f(v.A), f(v.B), f(v.Chroma), f(v.Hue), v.HueName, r.Toning}
+	}
+	rows := [][]string{
+		{"file", "region", "band", "min_l", "max_l", "pixels", "a", "b", "chroma", "hue", "hue_name", "toning"},
+		row("all", 0, 100, r.castValues),
+	}
+	for i, b := range r.Bands {
+		rows = append(rows, row(strconv.Itoa(i), b.MinL, b.MaxL, b.castValues))
+	}
+	return rows
+}
+
+func (r castReport) records() []any {
+	type record struct {
+		File   string `json:"file"`
+		Region string `json:"region"`
+		Band   string `json:"band"`
+		Toning string `json:"toning"`
+		castBand
+	}
+	recs := []any{record{r.File, r.Region, "all", r.Toning, castBand{0, 100, r.castValues}}}
+	for i, b := range r.Bands {
+		recs = append(recs, record{r.File, r.Region, strconv.Itoa(i), r.Toning, b})
+	}
+	return recs
+}
+
+func init() {
+	showCmd.AddCommand(castCmd)
+	addRegionFlags(castCmd)
+	castCmd.PersistentFlags().IntVar(&castBands, "bands", greyscale.DefaultCastBands, "number of tonal bands to measure the cast in")
+	castCmd.PersistentFlags().Float64Var(&castThreshold, "threshold", 1, "smallest chroma that counts as a noticeable cast")
+}
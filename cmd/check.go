@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+// exitNotGreyscale is the exit status of the check command when the image fails the check
+const exitNotGreyscale = 2
+
+var tolerance int
+var maxPercent float64
+var locations int
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "check that an image is truly greyscale",
+	Long: `
+The 'check' command looks at every pixel of the infile image and measures
+how far its red, green and blue values differ from each other. A pixel is
+non-neutral if the difference between its largest and smallest channel is
+more than --tolerance (on the 8-bit 0-255 scale).
+
+The command exits with status 0 if the image passes, 2 if more than
+--max-percent of its pixels are non-neutral, or 1 if there was an error.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if tolerance < 0 || tolerance > 255 {
+			log.Fatal(fmt.Errorf("--tolerance must be between 0 and 255"))
+		}
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var analyzer greyscale.Analyzer
+		// an 8-bit value v is stored as v*257 in 16 bits
+		result, err := analyzer.Check(m, tolerance*257, locations)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		report := newCheckReport(infile, tolerance*257, result)
+		err = writeReport(report)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !report.Passed {
+			os.Exit(exitNotGreyscale)
+		}
+		os.Exit(0)
+	},
+}
+
+// checkReport is the output of the check command.
+// Deviations are on the 16-bit scale.
+type checkReport struct {
+	File              string          `json:"file" yaml:"file"`
+	Passed            bool            `json:"passed" yaml:"passed"`
+	Pixels            int             `json:"pixels" yaml:"pixels"`
+	Tolerance         int             `json:"tolerance" yaml:"tolerance"`
+	MaxDeviation      int             `json:"max_deviation" yaml:"max_deviation"`
+	MeanDeviation     float64         `json:"mean_deviation" yaml:"mean_deviation"`
+	NonNeutral        int             `json:"non_neutral_pixels" yaml:"non_neutral_pixels"`
+	NonNeutralPercent float64         `json:"non_neutral_percent" yaml:"non_neutral_percent"`
+	Bounds            *checkBounds    `json:"bounds" yaml:"bounds"`
+	Locations         []checkLocation `json:"locations" yaml:"locations"`
+}
+
+// checkBounds is the rectangle that holds every non-neutral pixel
+type checkBounds struct {
+	MinX int `json:"min_x" yaml:"min_x"`
+	MinY int `json:"min_y" yaml:"min_y"`
+	MaxX int `json:"max_x" yaml:"max_x"`
+	MaxY int `json:"max_y" yaml:"max_y"`
+}
+
+// checkLocation is one non-neutral pixel
+type checkLocation struct {
+	X int `json:"x" yaml:"x"`
+	Y int `json:"y" yaml:"y"`
+}
+
+// newCheckReport makes a report from the result of a check
+func newCheckReport(file string, tolerance int, res *greyscale.CheckResult) checkReport {
+	r := checkReport{
+		File:              file,
+		Passed:            res.NonNeutralPercent() <= maxPercent,
+		Pixels:            res.Pixels,
+		Tolerance:         tolerance,
+		MaxDeviation:      res.MaxDeviation,
+		MeanDeviation:     res.MeanDeviation,
+		NonNeutral:        res.NonNeutral,
+		NonNeutralPercent: res.NonNeutralPercent(),
+		Locations:         []checkLocation{},
+	}
+	if !res.Greyscale() {
+		b := res.Bounds
+		r.Bounds = &checkBounds{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y}
+	}
+	for _, p := range res.Locations {
+		r.Locations = append(r.Locations, checkLocation{p.X, p.Y})
+	}
+	return r
+}
+
+func (r checkReport) kind() string { return "check" }
+
+func (r checkReport) table() string {
+	var out strings.Builder
+	if r.Passed {
+		out.WriteString("# Greyscale Check: Passed\n\n")
+	} else {
+		out.WriteString("# Greyscale Check: Failed\n\n")
+	}
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Tolerance|%d|\n", r.Tolerance/257))
+	out.WriteString(fmt.Sprintf("|Max Deviation|%.02f|\n", float64(r.MaxDeviation)/257))
+	out.WriteString(fmt.Sprintf("|Mean Deviation|%.04f|\n", r.MeanDeviation/257))
+	out.WriteString(fmt.Sprintf("|Non-neutral Pixels|%d of %d|\n", r.NonNeutral, r.Pixels))
+	out.WriteString(fmt.Sprintf("|Non-neutral Percent|%.02f%%|\n", r.NonNeutralPercent))
+	if r.Bounds != nil {
+		out.WriteString(fmt.Sprintf("|Non-neutral Area|%d x %d to %d x %d|\n", r.Bounds.MinX, r.Bounds.MinY, r.Bounds.MaxX, r.Bounds.MaxY))
+	}
+	if len(r.Locations) > 0 {
+		var points []string
+		for _, p := range r.Locations {
+			points = append(points, fmt.Sprintf("%d,%d", p.X, p.Y))
+		}
+		out.WriteString(fmt.Sprintf("|First Non-neutral Pixels|%s|\n", strings.Join(points, " ")))
+	}
+	out.WriteString("\n*Deviations are on the 8-bit (0-255) scale*\n")
+	return renderMarkdown(out.String())
+}
+
+func (r checkReport) csv() [][]string {
+	var bounds [4]string
+	if r.Bounds != nil {
+		bounds = [4]string{
+			strconv.Itoa(r.Bounds.MinX),
+			strconv.Itoa(r.Bounds.MinY),
+			strconv.Itoa(r.Bounds.MaxX),
+			strconv.Itoa(r.Bounds.MaxY),
+		}
+	}
+	return [][]string{
+		{"file", "passed", "pixels", "tolerance", "max_deviation", "mean_deviation", "non_neutral_pixels", "non_neutral_percent", "min_x", "min_y", "max_x", "max_y"},
+		{
+			r.File,
+			strconv.FormatBool(r.Passed),
+			strconv.Itoa(r.Pixels),
+			strconv.Itoa(r.Tolerance),
+			strconv.Itoa(r.MaxDeviation),
+			strconv.FormatFloat(r.MeanDeviation, 'f', -1, 64),
+			strconv.Itoa(r.NonNeutral),
+			fmt.Sprintf("%.02f", r.NonNeutralPercent),
+			bounds[0],
+			bounds[1],
+			bounds[2],
+			bounds[3],
+		},
+	}
+}
+
+func (r checkReport) records() []any {
+	return []any{r}
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	checkCmd.PersistentFlags().IntVarP(&tolerance, "tolerance", "t", 0, "largest difference between channels (0-255) that still counts as grey")
+	checkCmd.PersistentFlags().Float64Var(&maxPercent, "max-percent", 0, "largest percentage of non-neutral pixels that still passes")
+	checkCmd.PersistentFlags().IntVar(&locations, "locations", 10, "number of non-neutral pixel locations to list")
+	addStretchFlag(checkCmd)
+	checkCmd.MarkPersistentFlagRequired("infile")
+}
@@ -25,23 +25,21 @@ import (
 	"fmt"
 	"image"
 	"log"
-	"os"
-	"slices"
-	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/charmbracelet/glamour"
+	"github.com/rahji/greyscale/pkg/greyscale"
 	"github.com/spf13/cobra"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 var colorName string
-var pixels string
+var aggregate bool
+var saveFile string
 var top int
 var nonzero bool
 var csv bool
+var bins int
+var cdf bool
 
 // colorsCmd represents the colors command
 var colorsCmd = &cobra.Command{
@@ -51,204 +49,391 @@ var colorsCmd = &cobra.Command{
 The 'show colors' command displays a histogram, showing how much of
 the infile image is represented by each of 16 named greyscale colors.
 
+Use --bins to divide the greys into a different number of equal ranges,
+eg: --bins 256 for every 8-bit level or --bins 65536 for every 16-bit level.
+
+Use --cdf to add the cumulative pixel count and percentage for each bin.
+
+Use --aggregate with several files to combine them into one histogram, eg:
+for every page of a scanned book. Its percentages are weighted by pixels,
+and its image percentages give each image the same weight.
+
+Use --save to also write the histograms to a JSON file, so that histograms
+made on different machines can be combined with 'greyscale merge'.
+
+Use --pixels, --rect or --polygon to look at only part of the image.
+--rect and --polygon can be repeated, to show a histogram for each region.
+
+Use --mask to only look at the pixels where a same-sized mask image is
+not black, and --ignore-transparent to skip pixels whose alpha (0-255) is
+below a threshold. On its own, --ignore-transparent skips only fully
+transparent pixels.
+
 Note that the image is *assumed* to be a greyscale!
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		m, _, err := readImage(infile)
+		files, err := inputFiles(args)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		bounds := m.Bounds()
-		totalPixels := bounds.Max.X * bounds.Max.Y
-		pixelsConsidered := 0
-
-		var minRangeX, minRangeY int
-		pixelAmount := totalPixels // will get overwritten if --pixels is used
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		if pixels != "" {
-			// determine the starting coordinates based on --pixels flag
+		regions, err := selections()
+		if err != nil {
+			log.Fatal(err)
+		}
 
-			// turn xy:n into [xy n] strings
-			xyxyn := strings.Split(pixels, ":")
-			if len(xyxyn) != 2 {
-				log.Fatal(fmt.Errorf("--pixels flag must be specied as x,y:n"))
-			}
-			// turn xy into [x y] ints
-			xyxy := strings.Split(xyxyn[0], ",")
-			if len(xyxy) != 2 {
-				log.Fatal(fmt.Errorf("--pixels flag must be specied as x,y:n"))
-			}
-			minRangeX, err = strconv.Atoi(xyxy[0])
-			if err != nil {
-				log.Fatal(fmt.Errorf("x couldn't be converted to a number in --pixels flag"))
-			}
-			minRangeY, err = strconv.Atoi(xyxy[1])
-			if err != nil {
-				log.Fatal(fmt.Errorf("y couldn't be converted to a number in --pixels flag"))
-			}
-			// turn n into n int
-			pixelAmount, err = strconv.Atoi(xyxyn[1])
-			if err != nil {
-				log.Fatal(fmt.Errorf("number of pixels couldn't be converted to a number in --pixels flag"))
-			}
+		if _, err := greyscale.NewHistogram(bins); err != nil {
+			log.Fatal(fmt.Errorf("--bins: %w", err))
+		}
 
-			// validate the actual x and y values
-			if minRangeX > bounds.Max.X {
-				log.Fatal(fmt.Errorf("x value specifed with --pixels is larger than the image width"))
+		group := combine
+		if aggregate {
+			if colorName != "" {
+				log.Fatal(fmt.Errorf("--color can't be used with --aggregate"))
 			}
-			if minRangeY > bounds.Max.Y {
-				log.Fatal(fmt.Errorf("y value specifed with --pixels is larger than the image width"))
-			}
-		} else {
-			// otherwise, just start normally at the minimum bounds of the image (probably 0,0)
-			minRangeX = bounds.Min.X
-			minRangeY = bounds.Min.Y
-		}
-
-		// end pixels are always the max bounds of the image, but later we will
-		// break out of the loop early if --pixels was used
-		maxRangeX := bounds.Max.X
-		maxRangeY := bounds.Max.Y
-
-		var histogram [16]int
-		// An image's bounds do not necessarily start at (0, 0), so the two loops start
-		// at bounds.Min.Y and bounds.Min.X. Looping over Y first and X second is more
-		// likely to result in better memory access patterns than X first and Y second.
-	outer:
-		for y := minRangeY; y < maxRangeY; y++ {
-			for x := minRangeX; x < maxRangeX; x++ {
-				grey := getGrey(m, x, y)
-				histogram[grey]++
-				pixelsConsidered++
-				if pixelAmount == pixelsConsidered {
-					break outer
-				}
+			group = aggregateColors
+		}
+		if saveFile != "" {
+			if colorName != "" {
+				log.Fatal(fmt.Errorf("--color can't be used with --save"))
 			}
+			group = saveColors(saveFile, greyscale.NewHistogramFile(bins, analyzer.Luma, analyzer.Alpha), group)
 		}
 
 		if colorName != "" {
-			colorName = cases.Title(language.Und).String(colorName)
-			colorIndex := slices.Index(scale, colorName)
-			pct := float64(histogram[colorIndex]) / float64(pixelsConsidered) * 100
-			fmt.Println(pct)
-			os.Exit(0)
+			if _, err := greyscale.ScaleIndex(colorName); err != nil {
+				log.Fatal(fmt.Errorf("--color: %w", err))
+			}
 		}
 
-		if top > 0 {
-			histogram = topValues(histogram, top)
-		}
-
-		var out strings.Builder
-		if !csv {
-			out.WriteString("# Color Histogram\n")
-			out.WriteString("||Color Name|Min Value|Max Value|Pixels|Percent|\n")
-			out.WriteString("|:--:|----:|----:|----:|-----:|------:|\n")
-		}
-		for i, x := range histogram {
-			maxGreyValueRange := (i << 4) | 0x0F
-			minGreyValueRange := maxGreyValueRange - 15
-			pct := float64(x) / float64(pixelsConsidered) * 100
-			if (top > 0 || nonzero) && pct == 0 {
-				// --top causes the value to be zero, so skip it
-				// also skip a zero value if --nonzero was specified
-				continue
-			}
-			var outString string
-			if csv {
-				outString = "%d,%s,%d,%d,%d,%.02f\n"
-			} else {
-				outString = "|%d|%s|%3d|%3d|%d|%.02f%%|\n"
+		if csv {
+			// without a header, the histograms' rows can't be told apart
+			if colorName == "" && (len(regions) > 1 || batch && !aggregate) {
+				log.Fatal(fmt.Errorf("--csv can only show one histogram, use --output csv for several files or regions"))
 			}
-			out.WriteString(fmt.Sprintf(outString, i, scale[i], minGreyValueRange, maxGreyValueRange, histogram[i], pct))
+			output = "csv"
+			csvHeader = false
 		}
 
-		if !csv {
-			out.WriteString(fmt.Sprintf("\n*Pixels considered: %d of %d*\n", pixelsConsidered, totalPixels))
-			md, _ := glamour.Render(out.String(), "dark")
-			fmt.Print(md)
-		} else {
-			fmt.Print(out.String())
-		}
-		os.Exit(0)
+		analyzeFiles(files, group, eachPage(func(file string, m image.Image, _ string) ([]report, error) {
+			var reports []report
+			for _, sel := range regions {
+				a := analyzer
+				a.Region = sel.region
+				levels, err := a.Levels(m)
+				if err != nil {
+					return nil, err
+				}
+
+				if colorName != "" {
+					pct, err := levels.ColorPercent(colorName)
+					if err != nil {
+						return nil, err
+					}
+					reports = append(reports, percentReport{file, sel.label, colorName, pct})
+					continue
+				}
+
+				histogram, err := levels.Rebin(bins)
+				if err != nil {
+					return nil, fmt.Errorf("--bins: %w", err)
+				}
+
+				// the cumulative values always describe the whole histogram, even with --top
+				cumulative := histogram.Cumulative()
+				full := histogram
+				if top > 0 {
+					histogram = histogram.Top(top)
+				}
+				report := newColorsReport(file, sel.label, histogram, cumulative, top > 0 || nonzero)
+				report.histogram = full
+				reports = append(reports, report)
+			}
+			return reports, nil
+		}))
 	},
 }
 
-func init() {
-	showCmd.AddCommand(colorsCmd)
-	colorsCmd.PersistentFlags().StringVarP(&colorName, "color", "c", "", "greyscale color name (returns percentage of that color)")
-	colorsCmd.PersistentFlags().IntVarP(&top, "top", "t", 0, "filter the histogram to show only the the highest-frequency colors")
-	colorsCmd.PersistentFlags().StringVarP(&pixels, "pixels", "p", "", "range of pixels to look at (x,y:n)")
-	colorsCmd.PersistentFlags().BoolVarP(&nonzero, "nonzero", "n", false, "only show non-zero results")
-	colorsCmd.PersistentFlags().BoolVarP(&csv, "csv", "r", false, "show raw comma-delimited output")
+// percentReport is the output of the colors command with --color
+type percentReport struct {
+	File    string  `json:"file" yaml:"file"`
+	Region  string  `json:"region" yaml:"region"`
+	Color   string  `json:"color" yaml:"color"`
+	Percent float64 `json:"percent" yaml:"percent"`
 }
 
-// takes an image width and height, the coordinates of a starting pixel, and an amount of pixels to offset from that point
-// returns the new coordinates, clipped at the end of the image
-func movePixel(w, h, x, y, n int) (int, int) {
-	// calculate the starting position in 1D
-	startPos := y*w + x
+func (r percentReport) kind() string { return "color_percent" }
 
-	// calculate the new position in 1D
-	newPos := startPos + n
-	fmt.Printf("width:%d height:%d x=%d y=%d newPos=%d\n", w, h, x, y, newPos)
-	if newPos >= w*h { // clip coordinates to end of the image
-		return w - 1, h - 1
-	} else {
-		// return new position, converted back to 2D coordinates
-		newY := newPos / w
-		newX := newPos % w
-		return newX, newY
+func (r percentReport) table() string {
+	if batch {
+		return fmt.Sprintf("%s: %v\n", r.File, r.Percent)
+	}
+	return fmt.Sprintln(r.Percent)
+}
+
+func (r percentReport) csv() [][]string {
+	return [][]string{
+		{"file", "region", "color", "percent"},
+		{r.File, r.Region, r.Color, strconv.FormatFloat(r.Percent, 'f', -1, 64)},
 	}
 }
 
-// takes an image.Image and a set of coordinates
-// returns the amount of "grey" at that pixel (actually the amount of red since we just assume green and blue are the same)
-// the return value is shifted 12 bits to the right to put it in the range 0-15
-func getGrey(m image.Image, x int, y int) int {
-	r, _, _, _ := m.At(x, y).RGBA()
-	// A color's RGBA method returns values in the range [0, 65535].
-	// Shifting by 12 reduces this to the range [0, 15].
-	return int(r >> 12)
+func (r percentReport) records() []any {
+	return []any{r}
+}
+
+// colorsReport is the output of the colors command
+type colorsReport struct {
+	File       string `json:"file" yaml:"file"`
+	Region     string `json:"region" yaml:"region"`
+	Considered int    `json:"pixels_considered" yaml:"pixels_considered"`
+	Total      int    `json:"pixels_total" yaml:"pixels_total"`
+	BinCount   int    `json:"bin_count" yaml:"bin_count"`
+	// Images is the number of images in an aggregate histogram, or 0 for a single image
+	Images int         `json:"images,omitempty" yaml:"images,omitempty"`
+	Bins   []colorsBin `json:"bins" yaml:"bins"`
+	// histogram is kept for --aggregate, before --top is applied
+	histogram *greyscale.Histogram
+}
+
+// colorsBin is one line of the histogram
+type colorsBin struct {
+	Index   int     `json:"index" yaml:"index"`
+	Name    string  `json:"name" yaml:"name"`
+	Min     int     `json:"min" yaml:"min"`
+	Max     int     `json:"max" yaml:"max"`
+	Min16   int     `json:"min_16bit" yaml:"min_16bit"`
+	Max16   int     `json:"max_16bit" yaml:"max_16bit"`
+	Pixels  int     `json:"pixels" yaml:"pixels"`
+	Percent float64 `json:"percent" yaml:"percent"`
+	// CumulativePixels is the number of pixels in this bin and every darker bin
+	CumulativePixels  int     `json:"cumulative_pixels" yaml:"cumulative_pixels"`
+	CumulativePercent float64 `json:"cumulative_percent" yaml:"cumulative_percent"`
+	// ImagePercent is the mean of each image's percentage, in an aggregate histogram
+	ImagePercent *float64 `json:"image_percent,omitempty" yaml:"image_percent,omitempty"`
 }
 
-// topValues returns a 16-item array with only the highest `top` values
-// the rest of the items have their value set to 0
-func topValues(arr [16]int, top int) [16]int {
-	if top >= 16 {
-		return arr
+// newColorsReport makes a report from the histogram of a region and its cumulative counts,
+// optionally skipping the empty bins
+func newColorsReport(file, region string, h *greyscale.Histogram, cumulative []int, skipZero bool) colorsReport {
+	r := colorsReport{
+		File:       file,
+		Region:     region,
+		Considered: h.Considered,
+		Total:      h.Total,
+		BinCount:   h.Bins(),
+		Bins:       []colorsBin{},
+	}
+	for i, count := range h.Counts {
+		pct := h.Percent(i)
+		if skipZero && pct == 0 {
+			// --top causes the value to be zero, so skip it
+			// also skip a zero value if --nonzero was specified
+			continue
+		}
+		min, max := h.Range8(i)
+		min16, max16 := h.Range(i)
+		var cumulativePct float64
+		if h.Considered > 0 {
+			cumulativePct = float64(cumulative[i]) / float64(h.Considered) * 100
+		}
+		r.Bins = append(r.Bins, colorsBin{i, h.Name(i), min, max, min16, max16, count, pct, cumulative[i], cumulativePct, nil})
 	}
+	return r
+}
 
-	// make a struct to hold each histogram entry
-	type GreyValue struct {
-		GreyNumber int
-		Count      int
+// aggregateColors combines the histograms of many images into one for each region.
+// The percentages are weighted by pixels, so larger images count for more, and the
+// image percentages are the mean of each image's percentages, so every image counts the same.
+func aggregateColors(reports []report) report {
+	var regions []string
+	merged := map[string]*greyscale.Histogram{}
+	imagePct := map[string][]float64{}
+	images := map[string]int{}
+	for _, rep := range reports {
+		r := rep.(colorsReport)
+		h := r.histogram
+		if merged[r.Region] == nil {
+			regions = append(regions, r.Region)
+			merged[r.Region], _ = greyscale.NewHistogram(h.Bins())
+			imagePct[r.Region] = make([]float64, h.Bins())
+		}
+		merged[r.Region].Merge(h)
+		if h.Considered == 0 {
+			// an image with no pixels in the region has no percentages to average
+			continue
+		}
+		images[r.Region]++
+		for i := range h.Counts {
+			imagePct[r.Region][i] += h.Percent(i)
+		}
 	}
 
-	// make a slice of GreyValue structs from the array
-	var greys []GreyValue
-	for i, v := range arr {
-		grey := GreyValue{GreyNumber: i, Count: v}
-		greys = append(greys, grey)
+	var ret []report
+	for _, region := range regions {
+		h := merged[region]
+		cumulative := h.Cumulative()
+		if top > 0 {
+			h = h.Top(top)
+		}
+		r := newColorsReport("aggregate", region, h, cumulative, top > 0 || nonzero)
+		r.Images = images[region]
+		for i, b := range r.Bins {
+			var pct float64
+			if r.Images > 0 {
+				pct = imagePct[region][b.Index] / float64(r.Images)
+			}
+			r.Bins[i].ImagePercent = &pct
+		}
+		ret = append(ret, r)
 	}
+	return combine(ret)
+}
 
-	// reverse sort the slice by Count
-	sort.Slice(greys, func(i, j int) bool {
-		return greys[i].Count > greys[j].Count
-	})
+// saveColors returns a function that saves the histograms in reports to a file named f,
+// before grouping them with group
+func saveColors(f string, hf *greyscale.HistogramFile, group func([]report) report) func([]report) report {
+	return func(reports []report) report {
+		for _, rep := range reports {
+			r := rep.(colorsReport)
+			if err := hf.Add(r.File, r.Region, r.histogram); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := greyscale.WriteHistogramFile(f, hf); err != nil {
+			log.Fatal(fmt.Errorf("--save: %w", err))
+		}
+		return group(reports)
+	}
+}
+
+func (r colorsReport) kind() string { return "colors" }
+
+// wide reports whether there are too many bins to show their ranges as 8-bit values
+func (r colorsReport) wide() bool {
+	return r.BinCount > 256
+}
+
+// valueRange returns the range of the bin in the units used by the table and csv output
+func (r colorsReport) valueRange(b colorsBin) (int, int) {
+	if r.wide() {
+		return b.Min16, b.Max16
+	}
+	return b.Min, b.Max
+}
 
-	// make the output array from the slice
-	var ret [16]int
-	count := 0
-	for _, g := range greys {
-		ret[g.GreyNumber] = g.Count
-		count++
-		if count == top {
-			break
+func (r colorsReport) table() string {
+	var out strings.Builder
+	if r.Images > 0 {
+		out.WriteString("# Aggregate Color Histogram\n")
+	} else {
+		out.WriteString("# Color Histogram\n")
+	}
+	if r.wide() {
+		out.WriteString("||Color Name|Min Value (16-bit)|Max Value (16-bit)|Pixels|Percent|")
+	} else {
+		out.WriteString("||Color Name|Min Value|Max Value|Pixels|Percent|")
+	}
+	align := "|:--:|----:|----:|----:|-----:|------:|"
+	if r.Images > 0 {
+		out.WriteString("Image Percent|")
+		align += "------:|"
+	}
+	if cdf {
+		out.WriteString("Cumulative Pixels|Cumulative Percent|")
+		align += "-----:|------:|"
+	}
+	out.WriteString("\n" + align + "\n")
+	for _, b := range r.Bins {
+		min, max := r.valueRange(b)
+		out.WriteString(fmt.Sprintf("|%d|%s|%3d|%3d|%d|%.02f%%|", b.Index, b.Name, min, max, b.Pixels, b.Percent))
+		if b.ImagePercent != nil {
+			out.WriteString(fmt.Sprintf("%.02f%%|", *b.ImagePercent))
+		}
+		if cdf {
+			out.WriteString(fmt.Sprintf("%d|%.02f%%|", b.CumulativePixels, b.CumulativePercent))
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString(fmt.Sprintf("\n*Pixels considered: %d of %d*\n", r.Considered, r.Total))
+	if r.Images > 0 {
+		out.WriteString(fmt.Sprintf("\n*Images: %d. Percent is weighted by pixels, and Image Percent gives each image the same weight*\n", r.Images))
+	} else if batch {
+		out.WriteString(fmt.Sprintf("\n*File: %s*\n", r.File))
+	}
+	if r.Region != "all" {
+		out.WriteString(fmt.Sprintf("\n*Region: %s*\n", r.Region))
+	}
+	return renderMarkdown(out.String())
+}
+
+func (r colorsReport) csv() [][]string {
+	rows := [][]string{{"index", "name", "min", "max", "pixels", "percent"}}
+	if r.wide() {
+		rows[0] = []string{"index", "name", "min_16bit", "max_16bit", "pixels", "percent"}
+	}
+	if r.Images > 0 {
+		rows[0] = append(rows[0], "image_percent")
+	}
+	if cdf {
+		rows[0] = append(rows[0], "cumulative_pixels", "cumulative_percent")
+	}
+	// the legacy --csv output doesn't say which file and region each row is for
+	if csvHeader {
+		rows[0] = append([]string{"file", "region"}, rows[0]...)
+	}
+	for _, b := range r.Bins {
+		min, max := r.valueRange(b)
+		row := []string{
+			strconv.Itoa(b.Index),
+			b.Name,
+			strconv.Itoa(min),
+			strconv.Itoa(max),
+			strconv.Itoa(b.Pixels),
+			fmt.Sprintf("%.02f", b.Percent),
 		}
+		if b.ImagePercent != nil {
+			row = append(row, fmt.Sprintf("%.02f", *b.ImagePercent))
+		}
+		if cdf {
+			row = append(row, strconv.Itoa(b.CumulativePixels), fmt.Sprintf("%.02f", b.CumulativePercent))
+		}
+		if csvHeader {
+			row = append([]string{r.File, r.Region}, row...)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func (r colorsReport) records() []any {
+	var recs []any
+	for _, b := range r.Bins {
+		recs = append(recs, struct {
+			File   string `json:"file"`
+			Region string `json:"region"`
+			colorsBin
+		}{r.File, r.Region, b})
 	}
+	return recs
+}
 
-	return ret
+func init() {
+	showCmd.AddCommand(colorsCmd)
+	colorsCmd.PersistentFlags().StringVar(&saveFile, "save", "", "also save the histograms to a JSON file that 'greyscale merge' can read")
+	colorsCmd.PersistentFlags().BoolVar(&aggregate, "aggregate", false, "combine the histograms of all the infiles into one")
+	colorsCmd.PersistentFlags().StringVarP(&colorName, "color", "c", "", "greyscale color name (returns percentage of that color)")
+	colorsCmd.PersistentFlags().IntVarP(&top, "top", "t", 0, "filter the histogram to show only the the highest-frequency colors")
+	addRegionFlags(colorsCmd)
+	colorsCmd.PersistentFlags().BoolVarP(&nonzero, "nonzero", "n", false, "only show non-zero results")
+	colorsCmd.PersistentFlags().IntVarP(&bins, "bins", "b", greyscale.DefaultBins, "number of equal-width bins in the histogram (2-65536)")
+	colorsCmd.PersistentFlags().BoolVar(&cdf, "cdf", false, "add the cumulative distribution to the histogram")
+	colorsCmd.PersistentFlags().BoolVarP(&csv, "csv", "r", false, "show raw comma-delimited output (like --output csv, without the header)")
 }
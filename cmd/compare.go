@@ -0,0 +1,262 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var reference string
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "compare the tonal distributions of two images",
+	Long: `
+The 'compare' command measures how different the histogram of the infile
+image is from the histogram of a reference image, eg: to check whether a
+reprint or rescan matches the original. It shows these distances:
+
+  chi-square     symmetric chi-square distance, 0 (identical) to 1
+  bhattacharyya  Bhattacharyya distance, 0 (identical) to 1
+  intersection   share of pixels in common, 1 (identical) to 0
+  ks             Kolmogorov-Smirnov statistic, the largest gap between
+                 the cumulative distributions, 0 (identical) to 1
+  emd            Earth Mover's Distance, the average distance the greys
+                 have to move to match, on the 8-bit (0-255) scale
+
+followed by the percentage of pixels in each bin of both images, and the
+difference between them. The images can be different sizes.
+
+Use --pixels, --rect or --polygon to compare the same part of both images.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		refImage, _, err := readImage(reference)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		regions, err := selections()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var reports []report
+		for _, sel := range regions {
+			analyzer.Region = sel.region
+			h, err := histogramOf(analyzer, m)
+			if err != nil {
+				log.Fatal(fmt.Errorf("%s: %w", infile, err))
+			}
+			ref, err := histogramOf(analyzer, refImage)
+			if err != nil {
+				log.Fatal(fmt.Errorf("%s: %w", reference, err))
+			}
+			dist, err := greyscale.Compare(h, ref)
+			if err != nil {
+				log.Fatal(fmt.Errorf("%s: %w", sel.label, err))
+			}
+			reports = append(reports, newCompareReport(infile, reference, sel.label, h, ref, dist))
+		}
+
+		err = writeReport(combine(reports))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// histogramOf returns the histogram of m with --bins bins
+func histogramOf(analyzer greyscale.Analyzer, m image.Image) (*greyscale.Histogram, error) {
+	levels, err := analyzer.Levels(m)
+	if err != nil {
+		return nil, err
+	}
+	h, err := levels.Rebin(bins)
+	if err != nil {
+		return nil, fmt.Errorf("--bins: %w", err)
+	}
+	return h, nil
+}
+
+// compareReport is the output of the compare command
+type compareReport struct {
+	File                string          `json:"file" yaml:"file"`
+	Reference           string          `json:"reference" yaml:"reference"`
+	Region              string          `json:"region" yaml:"region"`
+	Considered          int             `json:"pixels_considered" yaml:"pixels_considered"`
+	ReferenceConsidered int             `json:"reference_pixels_considered" yaml:"reference_pixels_considered"`
+	BinCount            int             `json:"bin_count" yaml:"bin_count"`
+	Distance            compareDistance `json:"distance" yaml:"distance"`
+	Bins                []compareBin    `json:"bins" yaml:"bins"`
+}
+
+// compareDistance holds the distances between the histograms. EMD is on the 8-bit scale.
+type compareDistance struct {
+	ChiSquare     float64 `json:"chi_square" yaml:"chi_square"`
+	Bhattacharyya float64 `json:"bhattacharyya" yaml:"bhattacharyya"`
+	Intersection  float64 `json:"intersection" yaml:"intersection"`
+	KS            float64 `json:"ks" yaml:"ks"`
+	EMD           float64 `json:"emd" yaml:"emd"`
+}
+
+// compareBin is one line of the side-by-side histogram
+type compareBin struct {
+	Index            int     `json:"index" yaml:"index"`
+	Name             string  `json:"name" yaml:"name"`
+	Min              int     `json:"min" yaml:"min"`
+	Max              int     `json:"max" yaml:"max"`
+	Percent          float64 `json:"percent" yaml:"percent"`
+	ReferencePercent float64 `json:"reference_percent" yaml:"reference_percent"`
+	// Delta is Percent minus ReferencePercent
+	Delta float64 `json:"delta" yaml:"delta"`
+}
+
+// newCompareReport makes a report from the histograms of a region of two images
+func newCompareReport(file, ref, region string, h, refHist *greyscale.Histogram, d greyscale.Distance) compareReport {
+	r := compareReport{
+		File:                file,
+		Reference:           ref,
+		Region:              region,
+		Considered:          h.Considered,
+		ReferenceConsidered: refHist.Considered,
+		BinCount:            h.Bins(),
+		// an 8-bit value v is stored as v*257 in 16 bits
+		Distance: compareDistance{d.ChiSquare, d.Bhattacharyya, d.Intersection, d.KS, d.EMD / 257},
+		Bins:     []compareBin{},
+	}
+	for i := range h.Counts {
+		p, q := h.Percent(i), refHist.Percent(i)
+		if nonzero && p == 0 && q == 0 {
+			continue
+		}
+		min, max := h.Range8(i)
+		r.Bins = append(r.Bins, compareBin{i, h.Name(i), min, max, p, q, p - q})
+	}
+	return r
+}
+
+func (r compareReport) kind() string { return "compare" }
+
+func (r compareReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Histogram Comparison\n\n")
+	out.WriteString("|Distance|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Chi-square|%.04f|\n", r.Distance.ChiSquare))
+	out.WriteString(fmt.Sprintf("|Bhattacharyya|%.04f|\n", r.Distance.Bhattacharyya))
+	out.WriteString(fmt.Sprintf("|Intersection|%.04f|\n", r.Distance.Intersection))
+	out.WriteString(fmt.Sprintf("|Kolmogorov-Smirnov|%.04f|\n", r.Distance.KS))
+	out.WriteString(fmt.Sprintf("|Earth Mover's|%.02f|\n\n", r.Distance.EMD))
+	out.WriteString("## Bins\n\n")
+	out.WriteString("||Color Name|Min Value|Max Value|Infile|Reference|Delta|\n")
+	out.WriteString("|:--:|----:|----:|----:|-----:|-----:|-----:|\n")
+	for _, b := range r.Bins {
+		out.WriteString(fmt.Sprintf("|%d|%s|%3d|%3d|%.02f%%|%.02f%%|%+.02f|\n", b.Index, b.Name, b.Min, b.Max, b.Percent, b.ReferencePercent, b.Delta))
+	}
+	out.WriteString(fmt.Sprintf("\n*Pixels considered: %d in %s, %d in %s*\n", r.Considered, r.File, r.ReferenceConsidered, r.Reference))
+	if r.Region != "all" {
+		out.WriteString(fmt.Sprintf("\n*Region: %s*\n", r.Region))
+	}
+	return renderMarkdown(out.String())
+}
+
+func (r compareReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	rows := [][]string{
+		{"file", "reference", "region", "index", "name", "min", "max", "percent", "reference_percent", "delta", "chi_square", "bhattacharyya", "intersection", "ks", "emd"},
+	}
+	d := r.Distance
+	for _, b := range r.Bins {
+		rows = append(rows, []string{
+			r.File,
+			r.Reference,
+			r.Region,
+			strconv.Itoa(b.Index),
+			b.Name,
+			strconv.Itoa(b.Min),
+			strconv.Itoa(b.Max),
+			fmt.Sprintf("%.02f", b.Percent),
+			fmt.Sprintf("%.02f", b.ReferencePercent),
+			fmt.Sprintf("%.02f", b.Delta),
+			f(d.ChiSquare),
+			f(d.Bhattacharyya),
+			f(d.Intersection),
+			f(d.KS),
+			f(d.EMD),
+		})
+	}
+	return rows
+}
+
+func (r compareReport) records() []any {
+	type record struct {
+		File      string `json:"file"`
+		Reference string `json:"reference"`
+		Region    string `json:"region"`
+		compareBin
+	}
+	type distanceRecord struct {
+		File      string `json:"file"`
+		Reference string `json:"reference"`
+		Region    string `json:"region"`
+		compareDistance
+	}
+	recs := []any{distanceRecord{r.File, r.Reference, r.Region, r.Distance}}
+	for _, b := range r.Bins {
+		recs = append(recs, record{r.File, r.Reference, r.Region, b})
+	}
+	return recs
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	compareCmd.PersistentFlags().StringVar(&reference, "reference", "", "reference file to compare the infile to (required)")
+	compareCmd.PersistentFlags().IntVarP(&bins, "bins", "b", greyscale.DefaultBins, "number of equal-width bins in the histograms (2-65536)")
+	compareCmd.PersistentFlags().BoolVarP(&nonzero, "nonzero", "n", false, "only show bins that are non-zero in either image")
+	addLumaFlag(compareCmd, "red")
+	addAlphaFlags(compareCmd)
+	addStretchFlag(compareCmd)
+	addRegionFlags(compareCmd)
+	compareCmd.MarkPersistentFlagRequired("infile")
+	compareCmd.MarkPersistentFlagRequired("reference")
+}
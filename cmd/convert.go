@@ -0,0 +1,165 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var convertMethod string
+var mix []float64
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "convert a color image to greyscale",
+	Long: `
+The 'convert' command turns a color image into a single-channel greyscale
+PNG, so that the other commands can analyze it without a --luma formula.
+
+The --method chooses how the red, green and blue channels become a grey:
+
+  rec709      weighted as in HD video and sRGB (the default)
+  average     the mean of the three channels
+  lightness   halfway between the largest and smallest channels
+  channel:r   only the red channel (also channel:g and channel:b, or
+              red, green and blue)
+  desaturate  the luminance of the color, so the grey looks as bright
+              (also luminance)
+
+Any --luma formula name also works, eg: rec601 or max.
+
+Like an image editor's channel mixer, --mix multiplies the red, green and
+blue channels before they are combined, eg: --mix 1.5,1,0.5 brightens reds
+and darkens blues. Results are clipped to white.
+
+By default the output has the same bit depth as the input: 16 bits for
+16-bit images, and 8 bits otherwise. Use --depth to choose.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		method, err := greyscale.ParseConversion(convertMethod)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--method: %w", err))
+		}
+		if len(mix) != 3 {
+			log.Fatal("--mix must be three numbers, for red, green and blue")
+		}
+		for _, w := range mix {
+			if w < 0 {
+				log.Fatal("--mix numbers can't be negative")
+			}
+		}
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		analyzer.Luma = method
+
+		bits := depth
+		if bits == 0 {
+			bits = greyscale.BitDepth(m)
+		}
+		grey, err := analyzer.Neutralize(m, [3]float64(mix), bits)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--depth: %w", err))
+		}
+
+		err = greyscale.WriteImage(outfile, grey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(convertReport{
+			File:    infile,
+			Outfile: outfile,
+			Method:  convertMethod,
+			Depth:   bits,
+			Mix:     mix,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// convertReport is the output of the convert command
+type convertReport struct {
+	File    string    `json:"file" yaml:"file"`
+	Outfile string    `json:"outfile" yaml:"outfile"`
+	Method  string    `json:"method" yaml:"method"`
+	Depth   int       `json:"depth" yaml:"depth"`
+	Mix     []float64 `json:"mix" yaml:"mix"`
+}
+
+func (r convertReport) kind() string { return "convert" }
+
+func (r convertReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Converted Image\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Outfile|%s|\n", r.Outfile))
+	out.WriteString(fmt.Sprintf("|Method|%s|\n", r.Method))
+	out.WriteString(fmt.Sprintf("|Bit Depth|%d|\n", r.Depth))
+	out.WriteString(fmt.Sprintf("|Channel Mix|%g, %g, %g|\n\n", r.Mix[0], r.Mix[1], r.Mix[2]))
+	return renderMarkdown(out.String())
+}
+
+func (r convertReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return [][]string{
+		{"file", "outfile", "method", "depth", "red_mix", "green_mix", "blue_mix"},
+		{r.File, r.Outfile, r.Method, strconv.Itoa(r.Depth), f(r.Mix[0]), f(r.Mix[1]), f(r.Mix[2])},
+	}
+}
+
+func (r convertReport) records() []any {
+	return []any{r}
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	convertCmd.PersistentFlags().StringVarP(&outfile, "outfile", "O", "", "output PNG, PGM, PPM or PNM file (required)")
+	convertCmd.PersistentFlags().StringVarP(&convertMethod, "method", "m", "rec709", fmt.Sprintf("how to turn colors into greys (%s)", strings.Join(greyscale.ConversionNames(), ", ")))
+	convertCmd.PersistentFlags().Float64SliceVar(&mix, "mix", []float64{1, 1, 1}, "red, green and blue channel multipliers, applied before the method")
+	convertCmd.PersistentFlags().IntVarP(&depth, "depth", "d", 0, "bits per pixel of the output, 8 or 16 (default is the same as the input)")
+	addAlphaFlags(convertCmd)
+	addStretchFlag(convertCmd)
+	convertCmd.MarkPersistentFlagRequired("infile")
+	convertCmd.MarkPersistentFlagRequired("outfile")
+}
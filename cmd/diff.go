@@ -0,0 +1,236 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var diffMode string
+var diffThreshold int
+var gain float64
+var minPixels int
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "save an image that shows where two images differ",
+	Long: `
+The 'diff' command compares the grey values of the infile image and a
+reference image of the same size, and writes an image to the outfile
+that shows where they differ. The --mode chooses how it is drawn:
+
+  absolute   the size of each difference, from black (none) to white
+  signed     lighter pixels in red, darker pixels in blue, unchanged in white
+  threshold  the infile faded, with the changed pixels highlighted in red
+
+A pixel has changed if its grey value differs by more than --threshold
+(on the 8-bit 0-255 scale). Touching changed pixels are grouped into
+regions, and the bounding box and pixel count of each one is shown.
+Use --gain to multiply the differences, to make small ones visible in
+the absolute and signed modes.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if diffThreshold < 0 || diffThreshold > 255 {
+			log.Fatal(fmt.Errorf("--threshold must be between 0 and 255"))
+		}
+		if gain <= 0 {
+			log.Fatal(fmt.Errorf("--gain must be more than 0"))
+		}
+		mode, err := greyscale.ParseDiffMode(diffMode)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--mode: %w", err))
+		}
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		refImage, _, err := readImage(reference)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// an 8-bit value v is stored as v*257 in 16 bits
+		result, err := analyzer.Diff(m, refImage, mode, diffThreshold*257, gain)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = greyscale.WriteImage(outfile, result.Image)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(newDiffReport(infile, reference, outfile, mode, result))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// diffReport is the output of the diff command
+type diffReport struct {
+	File           string  `json:"file" yaml:"file"`
+	Reference      string  `json:"reference" yaml:"reference"`
+	Outfile        string  `json:"outfile" yaml:"outfile"`
+	Mode           string  `json:"mode" yaml:"mode"`
+	Threshold      int     `json:"threshold" yaml:"threshold"`
+	Pixels         int     `json:"pixels" yaml:"pixels"`
+	Changed        int     `json:"changed_pixels" yaml:"changed_pixels"`
+	ChangedPercent float64 `json:"changed_percent" yaml:"changed_percent"`
+	// MaxDifference is on the 8-bit scale
+	MaxDifference float64      `json:"max_difference" yaml:"max_difference"`
+	Regions       []diffRegion `json:"regions" yaml:"regions"`
+}
+
+// diffRegion is a group of touching changed pixels
+type diffRegion struct {
+	MinX   int `json:"min_x" yaml:"min_x"`
+	MinY   int `json:"min_y" yaml:"min_y"`
+	MaxX   int `json:"max_x" yaml:"max_x"`
+	MaxY   int `json:"max_y" yaml:"max_y"`
+	Width  int `json:"width" yaml:"width"`
+	Height int `json:"height" yaml:"height"`
+	Pixels int `json:"pixels" yaml:"pixels"`
+}
+
+// newDiffReport makes a report from the differences between two images,
+// leaving out the regions with fewer than --min-pixels pixels
+func newDiffReport(file, ref, out string, mode greyscale.DiffMode, res *greyscale.DiffResult) diffReport {
+	r := diffReport{
+		File:      file,
+		Reference: ref,
+		Outfile:   out,
+		Mode:      mode.String(),
+		Threshold: diffThreshold,
+		Pixels:    res.Pixels,
+		Changed:   res.Changed,
+		// an 8-bit value v is stored as v*257 in 16 bits
+		MaxDifference: float64(res.MaxDifference) / 257,
+		Regions:       []diffRegion{},
+	}
+	if res.Pixels > 0 {
+		r.ChangedPercent = float64(res.Changed) / float64(res.Pixels) * 100
+	}
+	for _, reg := range res.Regions {
+		if reg.Pixels < minPixels {
+			continue
+		}
+		b := reg.Bounds
+		r.Regions = append(r.Regions, diffRegion{b.Min.X, b.Min.Y, b.Max.X, b.Max.Y, b.Dx(), b.Dy(), reg.Pixels})
+	}
+	return r
+}
+
+func (r diffReport) kind() string { return "diff" }
+
+func (r diffReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Image Difference\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Outfile|%s|\n", r.Outfile))
+	out.WriteString(fmt.Sprintf("|Mode|%s|\n", r.Mode))
+	out.WriteString(fmt.Sprintf("|Changed Pixels|%d of %d (%.02f%%)|\n", r.Changed, r.Pixels, r.ChangedPercent))
+	out.WriteString(fmt.Sprintf("|Max Difference|%.02f|\n", r.MaxDifference))
+	out.WriteString(fmt.Sprintf("|Changed Regions|%d|\n\n", len(r.Regions)))
+	if len(r.Regions) > 0 {
+		out.WriteString("## Changed Regions\n\n")
+		out.WriteString("||Min Bounds|Max Bounds|Size|Pixels|\n")
+		out.WriteString("|:--:|:--|:--|:--|----:|\n")
+		for i, reg := range r.Regions {
+			out.WriteString(fmt.Sprintf("|%d|%d x %d|%d x %d|%dx%d|%d|\n", i, reg.MinX, reg.MinY, reg.MaxX, reg.MaxY, reg.Width, reg.Height, reg.Pixels))
+		}
+	}
+	out.WriteString(fmt.Sprintf("\n*Pixels changed by more than %d (on the 8-bit 0-255 scale)*\n", r.Threshold))
+	return renderMarkdown(out.String())
+}
+
+func (r diffReport) csv() [][]string {
+	rows := [][]string{
+		{"file", "reference", "outfile", "mode", "threshold", "region", "min_x", "min_y", "max_x", "max_y", "width", "height", "pixels"},
+	}
+	for i, reg := range r.Regions {
+		rows = append(rows, []string{
+			r.File,
+			r.Reference,
+			r.Outfile,
+			r.Mode,
+			strconv.Itoa(r.Threshold),
+			strconv.Itoa(i),
+			strconv.Itoa(reg.MinX),
+			strconv.Itoa(reg.MinY),
+			strconv.Itoa(reg.MaxX),
+			strconv.Itoa(reg.MaxY),
+			strconv.Itoa(reg.Width),
+			strconv.Itoa(reg.Height),
+			strconv.Itoa(reg.Pixels),
+		})
+	}
+	return rows
+}
+
+func (r diffReport) records() []any {
+	type record struct {
+		File      string `json:"file"`
+		Reference string `json:"reference"`
+		Region    int    `json:"region"`
+		diffRegion
+	}
+	var recs []any
+	for i, reg := range r.Regions {
+		recs = append(recs, record{r.File, r.Reference, i, reg})
+	}
+	return recs
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	diffCmd.PersistentFlags().StringVar(&reference, "reference", "", "reference file the same size as the infile (required)")
+	diffCmd.PersistentFlags().StringVarP(&outfile, "outfile", "O", "", "output image file (required)")
+	diffCmd.PersistentFlags().StringVarP(&diffMode, "mode", "m", "absolute", fmt.Sprintf("how to draw the differences (%s)", strings.Join(greyscale.DiffModeNames(), ", ")))
+	diffCmd.PersistentFlags().IntVarP(&diffThreshold, "threshold", "t", 0, "largest difference (0-255) that is ignored")
+	diffCmd.PersistentFlags().Float64Var(&gain, "gain", 1, "multiply the differences by this when drawing them")
+	diffCmd.PersistentFlags().IntVar(&minPixels, "min-pixels", 1, "only show changed regions with at least this many pixels")
+	addLumaFlag(diffCmd, "red")
+	addAlphaFlags(diffCmd)
+	addStretchFlag(diffCmd)
+	diffCmd.MarkPersistentFlagRequired("infile")
+	diffCmd.MarkPersistentFlagRequired("reference")
+	diffCmd.MarkPersistentFlagRequired("outfile")
+}
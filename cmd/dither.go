@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var ditherMethod string
+var serpentine bool
+
+// ditherCmd represents the dither command
+var ditherCmd = &cobra.Command{
+	Use:   "dither",
+	Short: "dither an image to a few grey levels and save it as a paletted PNG",
+	Long: `
+The 'dither' command reduces the infile image to a few evenly spaced greys,
+like 'quantize', but spreads the rounding error around so that smooth
+gradients don't turn into bands. This is useful for e-ink displays, which
+usually show 4 or 16 levels of grey.
+
+By default there are 16 levels, one for each of the named greys. Use
+--levels to choose a different number, from 2 to 256.
+
+The --method chooses how:
+
+  floyd-steinberg      error diffusion to 4 neighbours (the default)
+  atkinson             error diffusion of 3/4 of the error, for more contrast
+  jarvis-judice-ninke  error diffusion to 12 neighbours, smoother but slower
+  sierra               error diffusion to 10 neighbours
+  bayer2, bayer4,      ordered dithering with a 2x2, 4x4 or 8x8 Bayer matrix,
+  bayer8               which gives a regular crosshatch pattern
+  blue-noise           ordered dithering with a built-in 64x64 blue noise tile,
+                       which looks like fine grain without a pattern
+
+Error diffusion scans every other row from right to left, which avoids
+diagonal "worm" artifacts. Use --serpentine=false to scan every row from
+left to right.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		method, err := greyscale.ParseDither(ditherMethod)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--method: %w", err))
+		}
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := analyzer.Dither(m, levels, method, serpentine)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--levels: %w", err))
+		}
+
+		err = greyscale.WriteImage(outfile, out)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(newPaletteReport("dither", infile, outfile, out))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ditherCmd)
+	ditherCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	ditherCmd.PersistentFlags().StringVarP(&outfile, "outfile", "O", "", "output PNG, PGM, PPM or PNM file (required)")
+	ditherCmd.PersistentFlags().IntVarP(&levels, "levels", "L", greyscale.DefaultBins, "number of grey levels in the palette (2-256)")
+	ditherCmd.PersistentFlags().StringVarP(&ditherMethod, "method", "m", "floyd-steinberg", fmt.Sprintf("dithering method (%s)", strings.Join(greyscale.DitherNames(), ", ")))
+	ditherCmd.PersistentFlags().BoolVar(&serpentine, "serpentine", true, "scan alternate rows in opposite directions when diffusing errors")
+	addLumaFlag(ditherCmd, "red")
+	addAlphaFlags(ditherCmd)
+	addStretchFlag(ditherCmd)
+	ditherCmd.MarkPersistentFlagRequired("infile")
+	ditherCmd.MarkPersistentFlagRequired("outfile")
+}
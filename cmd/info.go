@@ -23,12 +23,12 @@ package cmd
 
 import (
 	"fmt"
-	"image/color"
+	"image"
 	"log"
-	"os"
+	"strconv"
 	"strings"
 
-	"github.com/charmbracelet/glamour"
+	"github.com/rahji/greyscale/pkg/greyscale"
 	"github.com/spf13/cobra"
 )
 
@@ -39,68 +39,237 @@ var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "show filetype, color model, and dimensions of an image",
 	Long: `
-Shows all image details by default. Using an optional flag restricts the output,
+Shows all image details by default, including how many pixels are opaque,
+translucent or fully transparent. Using an optional flag restricts the output,
 which can be useful for scripts or piping the output to another command.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		m, filetype, err := readImage(infile)
+		files, err := inputFiles(args)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		bounds := m.Bounds()
-		if width {
-			fmt.Println(bounds.Max.X - bounds.Min.X)
-			os.Exit(0)
+		sizeOnly := width || height || dimensions
+		group := fileTableOf("Image Info")
+		if sizeOnly {
+			// these print bare values, one line per file
+			group = combine
 		}
-		if height {
-			fmt.Println(bounds.Max.Y - bounds.Min.Y)
-			os.Exit(0)
-		}
-		if dimensions {
-			fmt.Printf("%dx%d\n", bounds.Max.X-bounds.Min.X, bounds.Max.Y-bounds.Min.Y)
-			os.Exit(0)
+
+		analyzeFiles(files, group, func(file string) ([]report, error) {
+			// the pages are named after the file, but the header is read from the file itself
+			return eachPage(func(name string, m image.Image, filetype string) ([]report, error) {
+				if sizeOnly {
+					return []report{newSizeReport(name, m.Bounds())}, nil
+				}
+				r := newInfoReport(name, greyscale.Inspect(m, filetype), greyscale.Coverage(m))
+				header, err := greyscale.ReadHeader(file, filetype)
+				if err != nil {
+					return nil, fmt.Errorf("header: %w", err)
+				}
+				r.Header = header
+				return []report{r}, nil
+			})(file)
+		})
+	},
+}
+
+// infoReport is the output of the info command
+type infoReport struct {
+	File       string `json:"file" yaml:"file"`
+	Format     string `json:"format" yaml:"format"`
+	ColorModel string `json:"color_model" yaml:"color_model"`
+	MinX       int    `json:"min_x" yaml:"min_x"`
+	MinY       int    `json:"min_y" yaml:"min_y"`
+	MaxX       int    `json:"max_x" yaml:"max_x"`
+	MaxY       int    `json:"max_y" yaml:"max_y"`
+	Width      int    `json:"width" yaml:"width"`
+	Height     int    `json:"height" yaml:"height"`
+	Pixels     int    `json:"pixels" yaml:"pixels"`
+	// the alpha values are on the 8-bit (0-255) scale
+	Opaque      int     `json:"opaque" yaml:"opaque"`
+	Translucent int     `json:"translucent" yaml:"translucent"`
+	Transparent int     `json:"transparent" yaml:"transparent"`
+	MinAlpha    int     `json:"min_alpha" yaml:"min_alpha"`
+	MaxAlpha    int     `json:"max_alpha" yaml:"max_alpha"`
+	MeanAlpha   float64 `json:"mean_alpha" yaml:"mean_alpha"`
+	// the fields of the file's header, for formats that have a HeaderReader (eg: BMP)
+	Header []greyscale.HeaderField `json:"header,omitempty" yaml:"header,omitempty"`
+}
+
+// newInfoReport makes a report from the details and alpha coverage of an image
+func newInfoReport(file string, info greyscale.ImageInfo, cov greyscale.AlphaCoverage) infoReport {
+	return infoReport{
+		File:       file,
+		Format:     info.Format,
+		ColorModel: info.ColorModel,
+		MinX:       info.Bounds.Min.X,
+		MinY:       info.Bounds.Min.Y,
+		MaxX:       info.Bounds.Max.X,
+		MaxY:       info.Bounds.Max.Y,
+		Width:      info.Width,
+		Height:     info.Height,
+		Pixels:     info.Pixels,
+		// an 8-bit value v is stored as v*257 in 16 bits
+		Opaque:      cov.Opaque,
+		Translucent: cov.Translucent,
+		Transparent: cov.Transparent,
+		MinAlpha:    int(cov.MinAlpha / 257),
+		MaxAlpha:    int(cov.MaxAlpha / 257),
+		MeanAlpha:   cov.MeanAlpha / 257,
+	}
+}
+
+func (r infoReport) kind() string { return "info" }
+
+func (r infoReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Image Info\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Filetype|%s|\n", r.Format))
+	out.WriteString(fmt.Sprintf("|Color Model|%s|\n", r.ColorModel))
+	out.WriteString(fmt.Sprintf("|Min Bounds|%d x %d|\n", r.MinX, r.MinY))
+	out.WriteString(fmt.Sprintf("|Max Bounds|%d x %d|\n", r.MaxX, r.MaxY))
+	out.WriteString(fmt.Sprintf("|Total Pixels|%d|\n\n", r.Pixels))
+	out.WriteString("## Alpha Coverage\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Opaque|%d (%.02f%%)|\n", r.Opaque, r.percent(r.Opaque)))
+	out.WriteString(fmt.Sprintf("|Translucent|%d (%.02f%%)|\n", r.Translucent, r.percent(r.Translucent)))
+	out.WriteString(fmt.Sprintf("|Transparent|%d (%.02f%%)|\n", r.Transparent, r.percent(r.Transparent)))
+	out.WriteString(fmt.Sprintf("|Alpha Range|%d-%d|\n", r.MinAlpha, r.MaxAlpha))
+	out.WriteString(fmt.Sprintf("|Mean Alpha|%.02f|\n\n", r.MeanAlpha))
+	if len(r.Header) > 0 {
+		out.WriteString(fmt.Sprintf("## %s Header\n\n", strings.ToUpper(r.Format)))
+		out.WriteString("|Field|Value|Comment|\n")
+		out.WriteString("|-----:|:-----|:-----|\n")
+		// a | would end the table cell
+		cell := strings.NewReplacer("|", "\\|").Replace
+		for _, f := range r.Header {
+			out.WriteString(fmt.Sprintf("|%s|%s|%s|\n", cell(f.Name), cell(f.Value), cell(f.Comment)))
 		}
+		out.WriteString("\n")
+	}
+	return renderMarkdown(out.String())
+}
+
+func (r infoReport) summary() ([]string, []string) {
+	return []string{"File", "Filetype", "Color Model", "Dimensions", "Opaque"},
+		[]string{r.File, r.Format, r.ColorModel, fmt.Sprintf("%dx%d", r.Width, r.Height), fmt.Sprintf("%.02f%%", r.percent(r.Opaque))}
+}
+
+// percent returns n as a percentage of the image's pixels
+func (r infoReport) percent(n int) float64 {
+	if r.Pixels == 0 {
+		return 0
+	}
+	return float64(n) / float64(r.Pixels) * 100
+}
 
-		numpix := bounds.Max.X * bounds.Max.Y
-
-		var colorModelName string
-		switch m.ColorModel() {
-		case color.RGBAModel:
-			colorModelName = "RGBA"
-		case color.RGBA64Model:
-			colorModelName = "RGBA64"
-		case color.NRGBAModel:
-			colorModelName = "NRGBA"
-		case color.NRGBA64Model:
-			colorModelName = "NRGBA64"
-		case color.AlphaModel:
-			colorModelName = "Alpha"
-		case color.Alpha16Model:
-			colorModelName = "Alpha16"
-		case color.GrayModel:
-			colorModelName = "Gray"
-		case color.Gray16Model:
-			colorModelName = "Gray16"
-		case color.CMYKModel:
-			colorModelName = "CMYK"
-		default:
-			colorModelName = "Unknown"
+// csv has a header_<name> column for each of the header fields, with repeated fields
+// (eg: FITS HISTORY cards) joined by "; "
+func (r infoReport) csv() [][]string {
+	rows := [][]string{
+		{"file", "format", "color_model", "min_x", "min_y", "max_x", "max_y", "width", "height", "pixels", "opaque", "translucent", "transparent", "min_alpha", "max_alpha", "mean_alpha"},
+		{
+			r.File,
+			r.Format,
+			r.ColorModel,
+			strconv.Itoa(r.MinX),
+			strconv.Itoa(r.MinY),
+			strconv.Itoa(r.MaxX),
+			strconv.Itoa(r.MaxY),
+			strconv.Itoa(r.Width),
+			strconv.Itoa(r.Height),
+			strconv.Itoa(r.Pixels),
+			strconv.Itoa(r.Opaque),
+			strconv.Itoa(r.Translucent),
+			strconv.Itoa(r.Transparent),
+			strconv.Itoa(r.MinAlpha),
+			strconv.Itoa(r.MaxAlpha),
+			strconv.FormatFloat(r.MeanAlpha, 'f', -1, 64),
+		},
+	}
+	column := map[string]int{}
+	for _, f := range r.Header {
+		name := "header_" + strings.Map(func(c rune) rune {
+			if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+				return c
+			}
+			return '_'
+		}, strings.ToLower(f.Name))
+		if i, ok := column[name]; ok {
+			rows[1][i] += "; " + f.Value
+			continue
 		}
+		column[name] = len(rows[0])
+		rows[0] = append(rows[0], name)
+		rows[1] = append(rows[1], f.Value)
+	}
+	return rows
+}
 
-		var out strings.Builder
-		out.WriteString("# Image Info\n\n")
-		out.WriteString("|Key|Value|\n")
-		out.WriteString("|-----:|:-----|\n")
-		out.WriteString(fmt.Sprintf("|Filetype|%s|\n", filetype))
-		out.WriteString(fmt.Sprintf("|Color Model|%s|\n", colorModelName))
-		out.WriteString(fmt.Sprintf("|Min Bounds|%d x %d|\n", bounds.Min.X, bounds.Min.Y))
-		out.WriteString(fmt.Sprintf("|Max Bounds|%d x %d|\n", bounds.Max.X, bounds.Max.Y))
-		out.WriteString(fmt.Sprintf("|Total Pixels|%d|\n\n", numpix))
-		md, _ := glamour.Render(out.String(), "dark")
-		fmt.Print(md)
-	},
+func (r infoReport) records() []any {
+	return []any{r}
+}
+
+// sizeReport is the output of the info command with --width, --height or --dimensions.
+// It only has the fields that were asked for.
+type sizeReport struct {
+	File   string `json:"file" yaml:"file"`
+	Width  *int   `json:"width,omitempty" yaml:"width,omitempty"`
+	Height *int   `json:"height,omitempty" yaml:"height,omitempty"`
+}
+
+// newSizeReport makes a report of the width and/or height of an image, following the flags
+func newSizeReport(file string, bounds image.Rectangle) sizeReport {
+	r := sizeReport{File: file}
+	if width || dimensions {
+		w := bounds.Dx()
+		r.Width = &w
+	}
+	if height || dimensions {
+		h := bounds.Dy()
+		r.Height = &h
+	}
+	return r
+}
+
+func (r sizeReport) kind() string { return "image_size" }
+
+func (r sizeReport) table() string {
+	var bare string
+	switch {
+	case r.Width != nil && r.Height != nil:
+		bare = fmt.Sprintf("%dx%d", *r.Width, *r.Height)
+	case r.Width != nil:
+		bare = strconv.Itoa(*r.Width)
+	default:
+		bare = strconv.Itoa(*r.Height)
+	}
+	if batch {
+		return fmt.Sprintf("%s: %s\n", r.File, bare)
+	}
+	return fmt.Sprintln(bare)
+}
+
+func (r sizeReport) csv() [][]string {
+	rows := [][]string{{"file"}, {r.File}}
+	if r.Width != nil {
+		rows[0] = append(rows[0], "width")
+		rows[1] = append(rows[1], strconv.Itoa(*r.Width))
+	}
+	if r.Height != nil {
+		rows[0] = append(rows[0], "height")
+		rows[1] = append(rows[1], strconv.Itoa(*r.Height))
+	}
+	return rows
+}
+
+func (r sizeReport) records() []any {
+	return []any{r}
 }
 
 func init() {
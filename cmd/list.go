@@ -22,9 +22,11 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"log"
+	"strconv"
 	"strings"
 
+	"github.com/rahji/greyscale/pkg/greyscale"
 	"github.com/spf13/cobra"
 )
 
@@ -34,11 +36,44 @@ var listCmd = &cobra.Command{
 	Short: "lists color names",
 	Long:  "displays the 16 color names used by this tool",
 	Run: func(cmd *cobra.Command, args []string) {
-		scaleStrings := strings.Join(scale[:], "\n")
-		fmt.Println(scaleStrings)
+		err := writeReport(listReport(greyscale.Scale))
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
+// listReport is the output of the list command
+type listReport []string
+
+// listRecord is one color name
+type listRecord struct {
+	Index int    `json:"index" yaml:"index"`
+	Name  string `json:"name" yaml:"name"`
+}
+
+func (r listReport) kind() string { return "list" }
+
+func (r listReport) table() string {
+	return strings.Join(r, "\n") + "\n"
+}
+
+func (r listReport) csv() [][]string {
+	rows := [][]string{{"index", "name"}}
+	for i, name := range r {
+		rows = append(rows, []string{strconv.Itoa(i), name})
+	}
+	return rows
+}
+
+func (r listReport) records() []any {
+	var recs []any
+	for i, name := range r {
+		recs = append(recs, listRecord{i, name})
+	}
+	return recs
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 }
@@ -0,0 +1,103 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge file.json...",
+	Short: "combine histograms saved by show colors --save",
+	Long: `
+The 'merge' command reads histogram files that were written by
+'show colors --save', possibly on different machines, and combines
+every image in them into one histogram for each region. It is shown
+the same way as 'show colors --aggregate'.
+
+All of the files must have the same number of bins and have been made
+with the same --luma and --alpha.
+
+Use --save to write all of the histograms to a single file, which can
+itself be merged later.
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		var merged *greyscale.HistogramFile
+		var reports []report
+		for _, f := range args {
+			hf, err := greyscale.ReadHistogramFile(f)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if merged == nil {
+				merged = hf
+			} else if hf.Bins != merged.Bins {
+				log.Fatal(fmt.Errorf("%s has %d bins, but %s has %d", f, hf.Bins, args[0], merged.Bins))
+			} else if hf.Luma != merged.Luma || hf.Alpha != merged.Alpha {
+				log.Fatal(fmt.Errorf("%s was made with --luma %s --alpha %s, but %s was made with --luma %s --alpha %s",
+					f, hf.Luma, hf.Alpha, args[0], merged.Luma, merged.Alpha))
+			} else {
+				merged.Histograms = append(merged.Histograms, hf.Histograms...)
+			}
+			for _, s := range hf.Histograms {
+				reports = append(reports, colorsReport{File: s.File, Region: s.Region, histogram: s.Histogram()})
+			}
+		}
+
+		if saveFile != "" {
+			if err := greyscale.WriteHistogramFile(saveFile, merged); err != nil {
+				log.Fatal(fmt.Errorf("--save: %w", err))
+			}
+		}
+
+		if csv {
+			output = "csv"
+			csvHeader = false
+		}
+
+		if len(reports) == 0 {
+			log.Fatal(fmt.Errorf("there are no histograms in %v", args))
+		}
+		err := writeReport(aggregateColors(reports))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+	mergeCmd.PersistentFlags().StringVar(&saveFile, "save", "", "save all of the histograms to a single JSON file")
+	mergeCmd.PersistentFlags().IntVarP(&top, "top", "t", 0, "filter the histogram to show only the the highest-frequency colors")
+	mergeCmd.PersistentFlags().BoolVarP(&nonzero, "nonzero", "n", false, "only show non-zero results")
+	mergeCmd.PersistentFlags().BoolVar(&cdf, "cdf", false, "add the cumulative distribution to the histogram")
+	mergeCmd.PersistentFlags().BoolVarP(&csv, "csv", "r", false, "show raw comma-delimited output (like --output csv, without the header)")
+}
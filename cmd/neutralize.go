@@ -0,0 +1,148 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var outfile string
+var depth int
+var noBalance bool
+
+// neutralizeCmd represents the neutralize command
+var neutralizeCmd = &cobra.Command{
+	Use:   "neutralize",
+	Short: "remove the color cast from an image and save it as a true greyscale",
+	Long: `
+The 'neutralize' command removes the tint from a near-greyscale image and
+writes the result as a single-channel greyscale PNG.
+
+First, the red, green and blue channels are balanced so that they all have
+the same average (use --no-balance to skip this). Then they are combined into
+one grey value using the --luma formula.
+
+By default the output has the same bit depth as the input: 16 bits for
+16-bit images, and 8 bits otherwise. Use --depth to choose.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		gains := [3]float64{1, 1, 1}
+		if !noBalance {
+			gains, err = analyzer.ChannelGains(m)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		bits := depth
+		if bits == 0 {
+			bits = greyscale.BitDepth(m)
+		}
+		grey, err := analyzer.Neutralize(m, gains, bits)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--depth: %w", err))
+		}
+
+		err = greyscale.WriteImage(outfile, grey)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(neutralizeReport{
+			File:    infile,
+			Outfile: outfile,
+			Luma:    analyzer.Luma.String(),
+			Depth:   bits,
+			Gains:   gains[:],
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// neutralizeReport is the output of the neutralize command
+type neutralizeReport struct {
+	File    string    `json:"file" yaml:"file"`
+	Outfile string    `json:"outfile" yaml:"outfile"`
+	Luma    string    `json:"luma" yaml:"luma"`
+	Depth   int       `json:"depth" yaml:"depth"`
+	Gains   []float64 `json:"gains" yaml:"gains"`
+}
+
+func (r neutralizeReport) kind() string { return "neutralize" }
+
+func (r neutralizeReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Neutralized Image\n\n")
+	out.WriteString("|Key|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|Outfile|%s|\n", r.Outfile))
+	out.WriteString(fmt.Sprintf("|Luma|%s|\n", r.Luma))
+	out.WriteString(fmt.Sprintf("|Bit Depth|%d|\n", r.Depth))
+	out.WriteString(fmt.Sprintf("|Channel Gains|%.04f, %.04f, %.04f|\n\n", r.Gains[0], r.Gains[1], r.Gains[2]))
+	return renderMarkdown(out.String())
+}
+
+func (r neutralizeReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return [][]string{
+		{"file", "outfile", "luma", "depth", "red_gain", "green_gain", "blue_gain"},
+		{r.File, r.Outfile, r.Luma, strconv.Itoa(r.Depth), f(r.Gains[0]), f(r.Gains[1]), f(r.Gains[2])},
+	}
+}
+
+func (r neutralizeReport) records() []any {
+	return []any{r}
+}
+
+func init() {
+	rootCmd.AddCommand(neutralizeCmd)
+	neutralizeCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	neutralizeCmd.PersistentFlags().StringVarP(&outfile, "outfile", "O", "", "output PNG, PGM, PPM or PNM file (required)")
+	neutralizeCmd.PersistentFlags().IntVarP(&depth, "depth", "d", 0, "bits per pixel of the output, 8 or 16 (default is the same as the input)")
+	neutralizeCmd.PersistentFlags().BoolVar(&noBalance, "no-balance", false, "don't balance the channels before combining them")
+	addLumaFlag(neutralizeCmd, "rec709")
+	addAlphaFlags(neutralizeCmd)
+	addStretchFlag(neutralizeCmd)
+	neutralizeCmd.MarkPersistentFlagRequired("infile")
+	neutralizeCmd.MarkPersistentFlagRequired("outfile")
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	encodingcsv "encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaVersion identifies the layout of the json, yaml and ndjson output.
+// It changes whenever a field is renamed or removed.
+const schemaVersion = "greyscale/v1"
+
+var outputFormats = []string{"table", "csv", "json", "yaml", "ndjson"}
+
+var output string
+
+// csvHeader is turned off by the legacy --csv flag, which never had a header row
+var csvHeader = true
+
+// a report is the result of a command, in a form that can be written in every --output format
+type report interface {
+	// kind names the type of report, eg: "colors"
+	kind() string
+	// table returns the human-readable output
+	table() string
+	// csv returns a header followed by one row per record
+	csv() [][]string
+	// records returns the individual records for ndjson output
+	records() []any
+}
+
+// envelope wraps report data with the schema version for json, yaml and ndjson output
+type envelope struct {
+	Schema string `json:"schema" yaml:"schema"`
+	Kind   string `json:"kind" yaml:"kind"`
+	Data   any    `json:"data" yaml:"data"`
+}
+
+// validateOutput checks the --output flag
+func validateOutput() error {
+	if !slices.Contains(outputFormats, output) {
+		return fmt.Errorf("--output must be one of %v", outputFormats)
+	}
+	return nil
+}
+
+// writeReport writes r to stdout in the --output format
+func writeReport(r report) error {
+	switch output {
+	case "csv":
+		rows := r.csv()
+		if !csvHeader {
+			rows = rows[1:]
+		}
+		w := encodingcsv.NewWriter(os.Stdout)
+		return w.WriteAll(rows)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(envelope{schemaVersion, r.kind(), r})
+	case "yaml":
+		enc := yaml.NewEncoder(os.Stdout)
+		defer enc.Close()
+		return enc.Encode(envelope{schemaVersion, r.kind(), r})
+	case "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		for _, rec := range r.records() {
+			if err := enc.Encode(envelope{schemaVersion, r.kind(), rec}); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		fmt.Print(r.table())
+		return nil
+	}
+}
+
+// renderMarkdown renders md as a fancy table for the terminal
+func renderMarkdown(md string) string {
+	out, err := glamour.Render(md, "dark")
+	if err != nil {
+		return md
+	}
+	return out
+}
+
+// reportList combines several reports of the same kind, eg: one for each region of an image.
+// In json and yaml its data is an array with one entry per report.
+type reportList []report
+
+// combine returns the only report in the list, or the whole list if there are several
+func combine(reports []report) report {
+	if len(reports) == 1 {
+		return reports[0]
+	}
+	return reportList(reports)
+}
+
+func (l reportList) kind() string { return l[0].kind() }
+
+func (l reportList) table() string {
+	var out strings.Builder
+	for _, r := range l {
+		out.WriteString(r.table())
+	}
+	return out.String()
+}
+
+// csv joins the reports' rows under one header. When the reports have different columns
+// (eg: the header fields of different formats), the header has all of them and missing cells are empty.
+func (l reportList) csv() [][]string {
+	tables := make([][][]string, len(l))
+	var header []string
+	column := map[string]int{}
+	same := true
+	for i, r := range l {
+		tables[i] = r.csv()
+		if i > 0 && !slices.Equal(tables[i][0], tables[0][0]) {
+			same = false
+		}
+		for _, name := range tables[i][0] {
+			if _, ok := column[name]; !ok {
+				column[name] = len(header)
+				header = append(header, name)
+			}
+		}
+	}
+	if same {
+		header = tables[0][0]
+	}
+
+	rows := [][]string{header}
+	for _, t := range tables {
+		for _, row := range t[1:] {
+			if same {
+				rows = append(rows, row)
+				continue
+			}
+			merged := make([]string, len(header))
+			for i, cell := range row {
+				merged[column[t[0][i]]] = cell
+			}
+			rows = append(rows, merged)
+		}
+	}
+	return rows
+}
+
+func (l reportList) records() []any {
+	var recs []any
+	for _, r := range l {
+		recs = append(recs, r.records()...)
+	}
+	return recs
+}
@@ -24,7 +24,9 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -39,7 +41,13 @@ var pickCmd = &cobra.Command{
 	Short: "show the exact greyscale color of a pixel",
 	Long: `
 This produces an a hex value for the color of the specifed pixel
-Again, it assumes the image is actually greyscale. 
+Again, it assumes the image is actually greyscale, unless --luma is
+used to combine the red, green and blue channels.
+
+Instead of -x and -y, use --pixels, --rect or --polygon to show the
+average grey of a region. --rect and --polygon can be repeated.
+--mask and --ignore-transparent apply to -x and -y too, and a pixel
+that they leave out is an error.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -48,33 +56,114 @@ Again, it assumes the image is actually greyscale.
 			log.Fatal(err)
 		}
 
-		bounds := m.Bounds()
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-		if x > bounds.Max.X {
-			log.Fatal(fmt.Errorf("x value is too large"))
+		if pixels == "" && len(rects) == 0 && len(polygons) == 0 {
+			if !cmd.Flags().Changed("x") || !cmd.Flags().Changed("y") {
+				log.Fatal(fmt.Errorf("-x and -y are required unless a region is given"))
+			}
+			value, err := analyzer.Pick(m, x, y)
+			if err != nil {
+				log.Fatal(err)
+			}
+			grey := value >> 8 // a right-shift of 8 turns 65535 max to 255 max
+			report := newPickReport(infile, fmt.Sprintf("pixel %d,%d", x, y), 1, int(grey))
+			report.X, report.Y = &x, &y
+			err = writeReport(report)
+			if err != nil {
+				log.Fatal(err)
+			}
+			os.Exit(0)
 		}
-		if y > bounds.Max.Y {
-			log.Fatal(fmt.Errorf("y value is too large"))
+
+		regions, err := selections()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var reports []report
+		for _, sel := range regions {
+			analyzer.Region = sel.region
+			levels, err := analyzer.Levels(m)
+			if err != nil {
+				log.Fatal(err)
+			}
+			stats, err := levels.Stats()
+			if err != nil {
+				log.Fatal(fmt.Errorf("%s: %w", sel.label, err))
+			}
+			// an 8-bit value v is stored as v*257 in 16 bits
+			grey := int(math.Round(stats.Mean / 257))
+			reports = append(reports, newPickReport(infile, sel.label, stats.Pixels, grey))
 		}
 
-		r, _, _, _ := m.At(x, y).RGBA()
-		grey := r >> 8 // a right-shift of 8 turns 65535 max to 255 max
-		if html {
-			fmt.Printf("#%x%x%x\n", grey, grey, grey)
-		} else {
-			fmt.Println(grey)
+		err = writeReport(combine(reports))
+		if err != nil {
+			log.Fatal(err)
 		}
 		os.Exit(0)
 	},
 }
 
+// pickReport is the output of the pick command.
+// For a region, the value is the average grey of its pixels.
+type pickReport struct {
+	File   string `json:"file" yaml:"file"`
+	Region string `json:"region" yaml:"region"`
+	Pixels int    `json:"pixels" yaml:"pixels"`
+	X      *int   `json:"x,omitempty" yaml:"x,omitempty"`
+	Y      *int   `json:"y,omitempty" yaml:"y,omitempty"`
+	Value  int    `json:"value" yaml:"value"`
+	Hex    string `json:"hex" yaml:"hex"`
+}
+
+// newPickReport makes a report for the 8-bit grey of a pixel or region
+func newPickReport(file, region string, pixels, grey int) pickReport {
+	return pickReport{
+		File:   file,
+		Region: region,
+		Pixels: pixels,
+		Value:  grey,
+		Hex:    fmt.Sprintf("#%02x%02x%02x", grey, grey, grey),
+	}
+}
+
+func (r pickReport) kind() string { return "pick" }
+
+func (r pickReport) table() string {
+	if html {
+		return fmt.Sprintln(r.Hex)
+	}
+	return fmt.Sprintln(r.Value)
+}
+
+func (r pickReport) csv() [][]string {
+	var px, py string
+	if r.X != nil {
+		px, py = strconv.Itoa(*r.X), strconv.Itoa(*r.Y)
+	}
+	return [][]string{
+		{"file", "region", "pixels", "x", "y", "value", "hex"},
+		{r.File, r.Region, strconv.Itoa(r.Pixels), px, py, strconv.Itoa(r.Value), r.Hex},
+	}
+}
+
+func (r pickReport) records() []any {
+	return []any{r}
+}
+
 func init() {
 	rootCmd.AddCommand(pickCmd)
 	pickCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
-	pickCmd.PersistentFlags().IntVarP(&x, "x", "x", 0, "x value for the pixel to be examined (required)")
-	pickCmd.PersistentFlags().IntVarP(&y, "y", "y", 0, "y value for the pixel to be examined (required)")
+	pickCmd.PersistentFlags().IntVarP(&x, "x", "x", 0, "x value for the pixel to be examined (required without a region)")
+	pickCmd.PersistentFlags().IntVarP(&y, "y", "y", 0, "y value for the pixel to be examined (required without a region)")
 	pickCmd.PersistentFlags().BoolVar(&html, "html", false, "output as an HTML hex string")
+	addLumaFlag(pickCmd, "red")
+	addAlphaFlags(pickCmd)
+	addStretchFlag(pickCmd)
+	addRegionFlags(pickCmd)
 	pickCmd.MarkPersistentFlagRequired("infile")
-	pickCmd.MarkPersistentFlagRequired("x")
-	pickCmd.MarkPersistentFlagRequired("y")
 }
@@ -0,0 +1,176 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var levels int
+
+// quantizeCmd represents the quantize command
+var quantizeCmd = &cobra.Command{
+	Use:   "quantize",
+	Short: "reduce an image to the named greys and save it as a paletted PNG",
+	Long: `
+The 'quantize' command replaces each pixel of the infile image with the
+grey that represents its bin, and writes the result as a paletted image.
+
+By default there are 16 levels, one for each of the named greys that
+'show colors' counts (see 'greyscale list'), so the palette of the output
+matches them. Use --levels to choose a different number, from 2 to 256.
+The palette greys are evenly spaced from black to white.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := analyzer.Quantize(m, levels)
+		if err != nil {
+			log.Fatal(fmt.Errorf("--levels: %w", err))
+		}
+
+		err = greyscale.WriteImage(outfile, out)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(newPaletteReport("quantize", infile, outfile, out))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// paletteReport is the output of commands that write a paletted image
+type paletteReport struct {
+	name    string
+	File    string         `json:"file" yaml:"file"`
+	Outfile string         `json:"outfile" yaml:"outfile"`
+	Levels  int            `json:"levels" yaml:"levels"`
+	Palette []paletteEntry `json:"palette" yaml:"palette"`
+}
+
+// paletteEntry is one grey of the palette, and how many pixels use it
+type paletteEntry struct {
+	Index   int     `json:"index" yaml:"index"`
+	Name    string  `json:"name" yaml:"name"`
+	Value   int     `json:"value" yaml:"value"`
+	Hex     string  `json:"hex" yaml:"hex"`
+	Pixels  int     `json:"pixels" yaml:"pixels"`
+	Percent float64 `json:"percent" yaml:"percent"`
+}
+
+// newPaletteReport makes a report of the palette of a grey paletted image
+func newPaletteReport(name, file, out string, m *image.Paletted) paletteReport {
+	counts := make([]int, len(m.Palette))
+	bounds := m.Bounds()
+	greyscale.Whole{}.Each(bounds, func(x, y int) {
+		counts[m.ColorIndexAt(x, y)]++
+	})
+	r := paletteReport{name: name, File: file, Outfile: out, Levels: len(m.Palette), Palette: []paletteEntry{}}
+	for i, c := range m.Palette {
+		v := int(c.(color.Gray).Y)
+		var pct float64
+		if n := bounds.Dx() * bounds.Dy(); n > 0 {
+			pct = float64(counts[i]) / float64(n) * 100
+		}
+		// an 8-bit value v is stored as v*257 in 16 bits
+		grey := greyscale.Scale[greyscale.Bin(uint16(v*257), greyscale.DefaultBins)]
+		r.Palette = append(r.Palette, paletteEntry{i, grey, v, fmt.Sprintf("#%02x%02x%02x", v, v, v), counts[i], pct})
+	}
+	return r
+}
+
+func (r paletteReport) kind() string { return r.name }
+
+func (r paletteReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Palette\n\n")
+	out.WriteString("||Color Name|Value|Hex|Pixels|Percent|\n")
+	out.WriteString("|:--:|----:|----:|----:|-----:|------:|\n")
+	for _, p := range r.Palette {
+		out.WriteString(fmt.Sprintf("|%d|%s|%3d|%s|%d|%.02f%%|\n", p.Index, p.Name, p.Value, p.Hex, p.Pixels, p.Percent))
+	}
+	out.WriteString(fmt.Sprintf("\n*Saved %d levels to %s*\n", r.Levels, r.Outfile))
+	return renderMarkdown(out.String())
+}
+
+func (r paletteReport) csv() [][]string {
+	rows := [][]string{{"file", "outfile", "index", "name", "value", "hex", "pixels", "percent"}}
+	for _, p := range r.Palette {
+		rows = append(rows, []string{
+			r.File,
+			r.Outfile,
+			strconv.Itoa(p.Index),
+			p.Name,
+			strconv.Itoa(p.Value),
+			p.Hex,
+			strconv.Itoa(p.Pixels),
+			fmt.Sprintf("%.02f", p.Percent),
+		})
+	}
+	return rows
+}
+
+func (r paletteReport) records() []any {
+	type record struct {
+		File    string `json:"file"`
+		Outfile string `json:"outfile"`
+		paletteEntry
+	}
+	var recs []any
+	for _, p := range r.Palette {
+		recs = append(recs, record{r.File, r.Outfile, p})
+	}
+	return recs
+}
+
+func init() {
+	rootCmd.AddCommand(quantizeCmd)
+	quantizeCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	quantizeCmd.PersistentFlags().StringVarP(&outfile, "outfile", "O", "", "output PNG, PGM, PPM or PNM file (required)")
+	quantizeCmd.PersistentFlags().IntVarP(&levels, "levels", "L", greyscale.DefaultBins, "number of grey levels in the palette (2-256)")
+	addLumaFlag(quantizeCmd, "red")
+	addAlphaFlags(quantizeCmd)
+	addStretchFlag(quantizeCmd)
+	quantizeCmd.MarkPersistentFlagRequired("infile")
+	quantizeCmd.MarkPersistentFlagRequired("outfile")
+}
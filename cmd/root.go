@@ -31,31 +31,15 @@ import (
 
 var cfgFile string
 
-var scale = []string{
-	"Black",
-	"Very Dark Gray",
-	"Dark Gray",
-	"Medium Dark Gray",
-	"Slate Gray",
-	"Dim Gray",
-	"Light Slate Gray",
-	"Gray",
-	"Light Gray",
-	"Gainsboro",
-	"Silver",
-	"Light Silver",
-	"Very Light Gray",
-	"Near White",
-	"Off White",
-	"White",
-}
-
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "greyscale",
 	Version: version,
 	Short:   "a tool for working with greyscale images",
 	Long:    "assuming your image is greyscale, it provides stats about its colors",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateOutput()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -75,6 +59,7 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.greyscale.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "table", "output format (table, csv, json, yaml or ndjson)")
 }
 
 // initConfig reads in config file and ENV variables if set.
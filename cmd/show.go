@@ -23,44 +23,153 @@ package cmd
 
 import (
 	"fmt"
-	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"runtime"
+	"strings"
 
-	"os"
-
+	_ "github.com/rahji/greyscale/pkg/bmp"
+	"github.com/rahji/greyscale/pkg/greyscale"
+	_ "github.com/rahji/greyscale/pkg/netpbm"
+	_ "github.com/rahji/greyscale/pkg/tiff"
 	"github.com/spf13/cobra"
 )
 
 var infile string
+var infiles []string
+var pixels string
+var rects []string
+var polygons []string
+var maskFile string
+var ignoreTransparent int
+var alphaMode string
+var background int
 
 // showCmd represents the show command
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "show greyscale info about an image",
-	Long:  "the subcommands colors and info do the actual work",
+	Long: `the subcommands colors, stats and info do the actual work.
+
+They can read many files at once: repeat --infile, list the files as
+arguments, or use a glob (eg: --infile 'scans/*.png') or a directory.
+Use --recursive to include subdirectories, and --jobs to choose how
+many files are read at the same time. A file that can't be read is
+reported without stopping the others.
+
+Multi-page images (eg: TIFF, or FITS cubes) are read from their first page. Use --page
+to choose another, or --all-pages to read each page as if it were a
+separate file.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Use 'show colors' or 'show info'")
+		fmt.Println("Use 'show colors', 'show stats' or 'show info'")
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(showCmd)
 
-	showCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
-	showCmd.MarkPersistentFlagRequired("infile")
+	showCmd.PersistentFlags().StringArrayVarP(&infiles, "infile", "i", nil, "input file, glob or directory, can be repeated (files can also be given as arguments)")
+	showCmd.PersistentFlags().BoolVarP(&recursive, "recursive", "R", false, "read the images in subdirectories of directories too")
+	showCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "number of files to read at the same time")
+	showCmd.PersistentFlags().IntVar(&pageNumber, "page", 1, "page of multi-page images (eg: TIFF or FITS cubes) to read")
+	showCmd.PersistentFlags().BoolVar(&allPages, "all-pages", false, "read every page of multi-page images")
+	addLumaFlag(showCmd, "red")
+	addAlphaFlags(showCmd)
+	addStretchFlag(showCmd)
 }
 
-// reads a file named f and returns
-// a decoded image, file format, and err
-func readImage(f string) (image.Image, string, error) {
-	reader, err := os.Open(f)
-	if err != nil {
-		return nil, "", fmt.Errorf("os.open: %w", err)
+// addLumaFlag adds the --luma flag, with a default formula, to a command that reads pixels.
+// The flag isn't bound to a variable, since each command can have a different default.
+func addLumaFlag(cmd *cobra.Command, value string) {
+	cmd.PersistentFlags().StringP("luma", "l", value, fmt.Sprintf("formula for turning colors into greys (%s)", strings.Join(greyscale.LumaNames(), ", ")))
+}
+
+// addAlphaFlags adds the flags that choose how translucent pixels are handled
+func addAlphaFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&alphaMode, "alpha", "ignore", fmt.Sprintf("how to handle translucent pixels (%s)", strings.Join(greyscale.AlphaNames(), ", ")))
+	cmd.PersistentFlags().IntVar(&background, "background", 255, "grey (0-255) that translucent pixels are composited over")
+}
+
+// addRegionFlags adds the flags that select which pixels of the image a command looks at
+func addRegionFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&pixels, "pixels", "p", "", "range of pixels to look at (x,y:n)")
+	cmd.PersistentFlags().StringArrayVar(&rects, "rect", nil, "rectangle of pixels to look at (x,y,w,h), can be repeated")
+	cmd.PersistentFlags().StringArrayVar(&polygons, "polygon", nil, "polygon of pixels to look at (x1,y1,x2,y2,...), can be repeated")
+	cmd.PersistentFlags().StringVar(&maskFile, "mask", "", "image file the same size as the infile, only look at pixels where it isn't black")
+	cmd.PersistentFlags().IntVar(&ignoreTransparent, "ignore-transparent", 0, "skip pixels with an alpha (0-255) below this value (1 if no value is given)")
+	cmd.PersistentFlags().Lookup("ignore-transparent").NoOptDefVal = "1"
+}
+
+// selection is a region of the image, with a label that identifies it in reports
+type selection struct {
+	label  string
+	region greyscale.Region
+}
+
+// selections returns the regions chosen with the region flags,
+// or the whole image if none were used
+func selections() ([]selection, error) {
+	var ret []selection
+	if pixels != "" {
+		run, err := greyscale.ParseRun(pixels)
+		if err != nil {
+			return nil, fmt.Errorf("--pixels: %w", err)
+		}
+		ret = append(ret, selection{"pixels " + run.String(), run})
+	}
+	for _, s := range rects {
+		rect, err := greyscale.ParseRect(s)
+		if err != nil {
+			return nil, fmt.Errorf("--rect: %w", err)
+		}
+		ret = append(ret, selection{"rect " + rect.String(), rect})
+	}
+	for _, s := range polygons {
+		polygon, err := greyscale.ParsePolygon(s)
+		if err != nil {
+			return nil, fmt.Errorf("--polygon: %w", err)
+		}
+		ret = append(ret, selection{"polygon " + polygon.String(), polygon})
 	}
-	defer reader.Close()
+	if len(ret) == 0 {
+		ret = append(ret, selection{"all", greyscale.Whole{}})
+	}
+	return ret, nil
+}
 
-	return image.Decode(reader)
+// newAnalyzer returns an Analyzer for the --luma, --alpha, --background, --mask
+// and --ignore-transparent flags of cmd
+func newAnalyzer(cmd *cobra.Command) (greyscale.Analyzer, error) {
+	var analyzer greyscale.Analyzer
+	var err error
+	// commands without a --luma flag set the Luma themselves
+	if cmd.Flags().Lookup("luma") != nil {
+		luma, _ := cmd.Flags().GetString("luma")
+		analyzer.Luma, err = greyscale.ParseLuma(luma)
+		if err != nil {
+			return analyzer, fmt.Errorf("--luma: %w", err)
+		}
+	}
+	analyzer.Alpha, err = greyscale.ParseAlpha(alphaMode)
+	if err != nil {
+		return analyzer, fmt.Errorf("--alpha: %w", err)
+	}
+	if background < 0 || background > 255 {
+		return analyzer, fmt.Errorf("--background must be between 0 and 255")
+	}
+	analyzer.Background = uint16(background * 257)
+	if maskFile != "" {
+		analyzer.Mask, _, err = readImage(maskFile)
+		if err != nil {
+			return analyzer, fmt.Errorf("--mask: %w", err)
+		}
+	}
+	if ignoreTransparent < 0 || ignoreTransparent > 255 {
+		return analyzer, fmt.Errorf("--ignore-transparent must be between 0 and 255")
+	}
+	// an 8-bit value v is stored as v*257 in 16 bits
+	analyzer.MinAlpha = uint32(ignoreTransparent) * 257
+	return analyzer, nil
 }
@@ -0,0 +1,255 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var tileSize int
+var worst int
+
+// similarityCmd represents the similarity command
+var similarityCmd = &cobra.Command{
+	Use:   "similarity",
+	Short: "measure how similar an image is to a reference image of the same size",
+	Long: `
+The 'similarity' command compares the infile image to a reference image of
+the same size, pixel by pixel, eg: to see how much an image was degraded
+by compression. It shows:
+
+  mae      mean absolute error, on the 8-bit (0-255) scale
+  mse      mean squared error, on the 8-bit scale
+  psnr     peak signal-to-noise ratio in decibels (higher is more similar)
+  ssim     structural similarity, from -1 to 1 (identical)
+  ms-ssim  multi-scale structural similarity, from 0 to 1 (identical)
+
+The images are also divided into --tile by --tile pixel tiles, and each
+one is measured separately, to find which part of the image changed the
+most. The table shows the --worst tiles with the lowest SSIM, and the
+other output formats include every tile.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		m, _, err := readImage(infile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		refImage, _, err := readImage(reference)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if tileSize < 0 {
+			log.Fatal(fmt.Errorf("--tile can't be negative"))
+		}
+		result, err := analyzer.CompareImages(m, refImage, tileSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeReport(newSimilarityReport(infile, reference, result))
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	},
+}
+
+// similarityReport is the output of the similarity command
+type similarityReport struct {
+	File             string `json:"file" yaml:"file"`
+	Reference        string `json:"reference" yaml:"reference"`
+	similarityValues `yaml:",inline"`
+	MSSSIM           float64          `json:"ms_ssim" yaml:"ms_ssim"`
+	Scales           int              `json:"ms_ssim_scales" yaml:"ms_ssim_scales"`
+	TileSize         int              `json:"tile_size" yaml:"tile_size"`
+	Tiles            []similarityTile `json:"tiles" yaml:"tiles"`
+}
+
+// similarityValues are the measures for the whole image or one tile.
+// PSNR is null when the pixels are identical.
+type similarityValues struct {
+	MAE  float64  `json:"mae" yaml:"mae"`
+	MSE  float64  `json:"mse" yaml:"mse"`
+	PSNR *float64 `json:"psnr" yaml:"psnr"`
+	SSIM float64  `json:"ssim" yaml:"ssim"`
+}
+
+// similarityTile is one tile of the images
+type similarityTile struct {
+	X                int `json:"x" yaml:"x"`
+	Y                int `json:"y" yaml:"y"`
+	Width            int `json:"width" yaml:"width"`
+	Height           int `json:"height" yaml:"height"`
+	similarityValues `yaml:",inline"`
+}
+
+func newSimilarityValues(s greyscale.Similarity) similarityValues {
+	v := similarityValues{MAE: s.MAE, MSE: s.MSE, SSIM: s.SSIM}
+	if !math.IsInf(s.PSNR, 1) {
+		v.PSNR = &s.PSNR
+	}
+	return v
+}
+
+// newSimilarityReport makes a report from the similarity of two images
+func newSimilarityReport(file, ref string, res *greyscale.SimilarityResult) similarityReport {
+	r := similarityReport{
+		File:             file,
+		Reference:        ref,
+		similarityValues: newSimilarityValues(res.Similarity),
+		MSSSIM:           res.MSSSIM,
+		Scales:           res.Scales,
+		TileSize:         tileSize,
+		Tiles:            []similarityTile{},
+	}
+	for _, t := range res.Tiles {
+		b := t.Bounds
+		r.Tiles = append(r.Tiles, similarityTile{b.Min.X, b.Min.Y, b.Dx(), b.Dy(), newSimilarityValues(t.Similarity)})
+	}
+	return r
+}
+
+// psnr formats a PSNR for the table
+func (v similarityValues) psnr() string {
+	if v.PSNR == nil {
+		return "∞"
+	}
+	return fmt.Sprintf("%.02f dB", *v.PSNR)
+}
+
+func (r similarityReport) kind() string { return "similarity" }
+
+func (r similarityReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Image Similarity\n\n")
+	out.WriteString("|Measure|Value|\n")
+	out.WriteString("|-----:|:-----|\n")
+	out.WriteString(fmt.Sprintf("|MAE|%.04f|\n", r.MAE))
+	out.WriteString(fmt.Sprintf("|MSE|%.04f|\n", r.MSE))
+	out.WriteString(fmt.Sprintf("|PSNR|%s|\n", r.psnr()))
+	out.WriteString(fmt.Sprintf("|SSIM|%.04f|\n", r.SSIM))
+	out.WriteString(fmt.Sprintf("|MS-SSIM|%.04f (%d scales)|\n\n", r.MSSSIM, r.Scales))
+
+	if len(r.Tiles) > 0 {
+		tiles := slices.Clone(r.Tiles)
+		slices.SortStableFunc(tiles, func(a, b similarityTile) int {
+			return cmpFloat(a.SSIM, b.SSIM)
+		})
+		if worst > 0 && len(tiles) > worst {
+			tiles = tiles[:worst]
+		}
+		out.WriteString(fmt.Sprintf("## Least Similar Tiles (%d of %d)\n\n", len(tiles), len(r.Tiles)))
+		out.WriteString("|Tile|Size|MAE|MSE|PSNR|SSIM|\n")
+		out.WriteString("|:--|:--|----:|----:|----:|----:|\n")
+		for _, t := range tiles {
+			out.WriteString(fmt.Sprintf("|%d,%d|%dx%d|%.04f|%.04f|%s|%.04f|\n", t.X, t.Y, t.Width, t.Height, t.MAE, t.MSE, t.psnr(), t.SSIM))
+		}
+	}
+	out.WriteString("\n*Errors are on the 8-bit (0-255) scale*\n")
+	return renderMarkdown(out.String())
+}
+
+// cmpFloat orders two floats from smallest to largest
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (r similarityReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	psnr := func(v similarityValues) string {
+		if v.PSNR == nil {
+			return "inf"
+		}
+		return f(*v.PSNR)
+	}
+	rows := [][]string{
+		{"file", "reference", "tile", "x", "y", "width", "height", "mae", "mse", "psnr", "ssim", "ms_ssim"},
+		{r.File, r.Reference, "all", "", "", "", "", f(r.MAE), f(r.MSE), psnr(r.similarityValues), f(r.SSIM), f(r.MSSSIM)},
+	}
+	for i, t := range r.Tiles {
+		rows = append(rows, []string{
+			r.File,
+			r.Reference,
+			strconv.Itoa(i),
+			strconv.Itoa(t.X),
+			strconv.Itoa(t.Y),
+			strconv.Itoa(t.Width),
+			strconv.Itoa(t.Height),
+			f(t.MAE),
+			f(t.MSE),
+			psnr(t.similarityValues),
+			f(t.SSIM),
+			"",
+		})
+	}
+	return rows
+}
+
+func (r similarityReport) records() []any {
+	type record struct {
+		File      string `json:"file"`
+		Reference string `json:"reference"`
+		Tile      string `json:"tile"`
+		similarityTile
+		MSSSIM *float64 `json:"ms_ssim,omitempty"`
+	}
+	recs := []any{record{r.File, r.Reference, "all", similarityTile{similarityValues: r.similarityValues}, &r.MSSSIM}}
+	for i, t := range r.Tiles {
+		recs = append(recs, record{r.File, r.Reference, strconv.Itoa(i), t, nil})
+	}
+	return recs
+}
+
+func init() {
+	rootCmd.AddCommand(similarityCmd)
+	similarityCmd.PersistentFlags().StringVarP(&infile, "infile", "i", "", "input file (required)")
+	similarityCmd.PersistentFlags().StringVar(&reference, "reference", "", "reference file the same size as the infile (required)")
+	similarityCmd.PersistentFlags().IntVar(&tileSize, "tile", 64, "size of the square tiles that are measured separately (0 for none)")
+	similarityCmd.PersistentFlags().IntVar(&worst, "worst", 10, "number of least similar tiles to show in the table (0 for all)")
+	addLumaFlag(similarityCmd, "red")
+	addAlphaFlags(similarityCmd)
+	addStretchFlag(similarityCmd)
+	similarityCmd.MarkPersistentFlagRequired("infile")
+	similarityCmd.MarkPersistentFlagRequired("reference")
+}
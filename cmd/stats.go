@@ -0,0 +1,275 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var percentiles string
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "show descriptive statistics for the greys in an image",
+	Long: `
+The 'show stats' command reports the min, max, mean, median, mode,
+standard deviation, skewness, kurtosis and number of unique levels
+of the grey values in the infile image.
+
+The statistics are calculated from the full 16-bit grey values, not
+the 16 named greys. Values are shown on both the 8-bit (0-255) and
+16-bit (0-65535) scales.
+
+Use --percentile to also show the grey value at each of a comma-separated
+list of percentiles, eg: --percentile 1,5,50,95,99
+
+Use --pixels, --rect or --polygon to look at only part of the image.
+--rect and --polygon can be repeated, to show statistics for each region.
+
+Use --mask to only look at the pixels where a same-sized mask image is
+not black, and --ignore-transparent to skip pixels whose alpha (0-255) is
+below a threshold. On its own, --ignore-transparent skips only fully
+transparent pixels.
+
+Note that the image is *assumed* to be a greyscale!
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		files, err := inputFiles(args)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		analyzer, err := newAnalyzer(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		regions, err := selections()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var ps []float64
+		if percentiles != "" {
+			for _, field := range strings.Split(percentiles, ",") {
+				p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil {
+					log.Fatal(fmt.Errorf("--percentile: %q couldn't be converted to a number", field))
+				}
+				if p < 0 || p > 100 || math.IsNaN(p) {
+					log.Fatal(fmt.Errorf("--percentile: %v must be between 0 and 100", p))
+				}
+				ps = append(ps, p)
+			}
+		}
+
+		analyzeFiles(files, fileTableOf("Grey Statistics"), eachPage(func(file string, m image.Image, _ string) ([]report, error) {
+			var reports []report
+			for _, sel := range regions {
+				a := analyzer
+				a.Region = sel.region
+				levels, err := a.Levels(m)
+				if err != nil {
+					return nil, err
+				}
+				report, err := newStatsReport(file, sel.label, levels, ps)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", sel.label, err)
+				}
+				reports = append(reports, report)
+			}
+			return reports, nil
+		}))
+	},
+}
+
+// statsReport is the output of the stats command.
+// Values are on the 16-bit scale.
+type statsReport struct {
+	File       string  `json:"file" yaml:"file"`
+	Region     string  `json:"region" yaml:"region"`
+	Considered int     `json:"pixels_considered" yaml:"pixels_considered"`
+	Total      int     `json:"pixels_total" yaml:"pixels_total"`
+	Min        float64 `json:"min" yaml:"min"`
+	Max        float64 `json:"max" yaml:"max"`
+	Mean       float64 `json:"mean" yaml:"mean"`
+	Median     float64 `json:"median" yaml:"median"`
+	Mode       float64 `json:"mode" yaml:"mode"`
+	StdDev     float64 `json:"stddev" yaml:"stddev"`
+	Skewness   float64 `json:"skewness" yaml:"skewness"`
+	Kurtosis   float64 `json:"kurtosis" yaml:"kurtosis"`
+	Unique     int     `json:"unique_levels" yaml:"unique_levels"`
+
+	Percentiles []statsPercentile `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
+}
+
+// statsPercentile is the grey value at a percentile
+type statsPercentile struct {
+	Percentile float64 `json:"percentile" yaml:"percentile"`
+	Value      float64 `json:"value" yaml:"value"`
+}
+
+// label returns a short name for the percentile, eg: p99
+func (p statsPercentile) label() string {
+	return "p" + strconv.FormatFloat(p.Percentile, 'f', -1, 64)
+}
+
+// newStatsReport makes a report from the full-precision histogram of a region,
+// including the grey value at each of the percentiles ps
+func newStatsReport(file, region string, levels *greyscale.Histogram, ps []float64) (statsReport, error) {
+	var r statsReport
+	s, err := levels.Stats()
+	if err != nil {
+		return r, err
+	}
+	r = statsReport{
+		File:       file,
+		Region:     region,
+		Considered: s.Pixels,
+		Total:      levels.Total,
+		Min:        s.Min,
+		Max:        s.Max,
+		Mean:       s.Mean,
+		Median:     s.Median,
+		Mode:       s.Mode,
+		StdDev:     s.StdDev,
+		Skewness:   s.Skewness,
+		Kurtosis:   s.Kurtosis,
+		Unique:     s.Unique,
+	}
+	for _, p := range ps {
+		value, err := levels.Percentile(p)
+		if err != nil {
+			return r, fmt.Errorf("--percentile: %w", err)
+		}
+		r.Percentiles = append(r.Percentiles, statsPercentile{p, value})
+	}
+	return r, nil
+}
+
+func (r statsReport) kind() string { return "stats" }
+
+func (r statsReport) table() string {
+	var out strings.Builder
+	out.WriteString("# Grey Statistics\n\n")
+	out.WriteString("|Statistic|8-bit|16-bit|\n")
+	out.WriteString("|-----:|-----:|-----:|\n")
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"Min", r.Min},
+		{"Max", r.Max},
+		{"Mean", r.Mean},
+		{"Median", r.Median},
+		{"Mode", r.Mode},
+		{"Standard Deviation", r.StdDev},
+	} {
+		// an 8-bit value v is stored as v*257 in 16 bits
+		out.WriteString(fmt.Sprintf("|%s|%.02f|%.02f|\n", v.name, v.value/257, v.value))
+	}
+	for _, p := range r.Percentiles {
+		out.WriteString(fmt.Sprintf("|%s Percentile|%.02f|%.02f|\n", ordinal(p.Percentile), p.Value/257, p.Value))
+	}
+	out.WriteString(fmt.Sprintf("|Skewness|%.04f||\n", r.Skewness))
+	out.WriteString(fmt.Sprintf("|Kurtosis|%.04f||\n", r.Kurtosis))
+	out.WriteString(fmt.Sprintf("|Unique Levels||%d|\n", r.Unique))
+	out.WriteString(fmt.Sprintf("\n*Pixels considered: %d of %d*\n", r.Considered, r.Total))
+	if r.Region != "all" {
+		out.WriteString(fmt.Sprintf("\n*Region: %s*\n", r.Region))
+	}
+	return renderMarkdown(out.String())
+}
+
+func (r statsReport) summary() ([]string, []string) {
+	// an 8-bit value v is stored as v*257 in 16 bits
+	f := func(v float64) string { return fmt.Sprintf("%.02f", v/257) }
+	return []string{"File", "Region", "Pixels", "Min", "Max", "Mean", "Median", "Std Dev"},
+		[]string{r.File, r.Region, strconv.Itoa(r.Considered), f(r.Min), f(r.Max), f(r.Mean), f(r.Median), f(r.StdDev)}
+}
+
+func (r statsReport) csv() [][]string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	rows := [][]string{
+		{"file", "region", "pixels_considered", "pixels_total", "min", "max", "mean", "median", "mode", "stddev", "skewness", "kurtosis", "unique_levels"},
+		{
+			r.File,
+			r.Region,
+			strconv.Itoa(r.Considered),
+			strconv.Itoa(r.Total),
+			f(r.Min),
+			f(r.Max),
+			f(r.Mean),
+			f(r.Median),
+			f(r.Mode),
+			f(r.StdDev),
+			f(r.Skewness),
+			f(r.Kurtosis),
+			strconv.Itoa(r.Unique),
+		},
+	}
+	for _, p := range r.Percentiles {
+		rows[0] = append(rows[0], p.label())
+		rows[1] = append(rows[1], f(p.Value))
+	}
+	return rows
+}
+
+// ordinal formats a percentile as an ordinal number, eg: 1st, 2nd, 99.5th
+func ordinal(p float64) string {
+	s := strconv.FormatFloat(p, 'f', -1, 64)
+	if p != float64(int(p)) {
+		return s + "th"
+	}
+	n := int(p)
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return s + "th"
+	case n%10 == 1:
+		return s + "st"
+	case n%10 == 2:
+		return s + "nd"
+	case n%10 == 3:
+		return s + "rd"
+	}
+	return s + "th"
+}
+
+func (r statsReport) records() []any {
+	return []any{r}
+}
+
+func init() {
+	showCmd.AddCommand(statsCmd)
+	addRegionFlags(statsCmd)
+	statsCmd.PersistentFlags().StringVar(&percentiles, "percentile", "", "comma-separated percentiles to show the grey value of (eg: 5,50,95)")
+}
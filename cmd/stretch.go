@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"image"
+	"io"
+	"os"
+
+	"github.com/rahji/greyscale/pkg/fits"
+	"github.com/rahji/greyscale/pkg/greyscale"
+	"github.com/spf13/cobra"
+)
+
+var stretch = fits.MinMax
+
+// stretchFlag is the value of the --stretch flag, which is checked as it's parsed
+type stretchFlag struct{ s *fits.Stretch }
+
+func (f stretchFlag) String() string { return f.s.String() }
+func (f stretchFlag) Type() string   { return "string" }
+
+func (f stretchFlag) Set(v string) error {
+	s, err := fits.ParseStretch(v)
+	if err != nil {
+		return err
+	}
+	*f.s = s
+	return nil
+}
+
+// addStretchFlag adds the --stretch flag to a command that reads images
+func addStretchFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Var(stretchFlag{&stretch}, "stretch", "how FITS values become greys (minmax, percentile, percentile:LOW,HIGH or range:MIN,MAX)")
+}
+
+// readPages is like greyscale.ReadPages, but FITS images are stretched with --stretch
+func readPages(file string, pages []int) ([]image.Image, string, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return greyscale.ReadPages(file, pages)
+	}
+	defer f.Close()
+	if _, format, err := image.DecodeConfig(f); err != nil || format != "fits" {
+		return greyscale.ReadPages(file, pages)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, "", 0, err
+	}
+	images, n, err := fits.DecodeStretch(f, pages, stretch)
+	return images, "fits", n, err
+}
+
+// readImage is like greyscale.ReadImage, but FITS images are stretched with --stretch
+func readImage(file string) (image.Image, string, error) {
+	images, format, _, err := readPages(file, []int{0})
+	if err != nil {
+		return nil, format, err
+	}
+	return images[0], format, nil
+}
@@ -0,0 +1,533 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package bmp decodes Windows and OS/2 bitmap (BMP) images with 1, 4, 8, 16, 24 or 32 bits
+// per pixel, uncompressed, RLE4 or RLE8 compressed, or with bit field masks.
+//
+// Importing it registers the decoder with the image package, like image/png does.
+package bmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+	"strconv"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+)
+
+func init() {
+	image.RegisterFormat("bmp", "BM", Decode, DecodeConfig)
+	greyscale.RegisterHeaderReader("bmp", func(r io.Reader) ([]greyscale.HeaderField, error) {
+		h, err := DecodeHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		return h.Fields(), nil
+	})
+}
+
+// compression methods
+const (
+	compressionRGB            = 0
+	compressionRLE8           = 1
+	compressionRLE4           = 2
+	compressionBitFields      = 3
+	compressionAlphaBitFields = 6
+)
+
+var compressionNames = map[uint32]string{
+	compressionRGB:            "BI_RGB",
+	compressionRLE8:           "BI_RLE8",
+	compressionRLE4:           "BI_RLE4",
+	compressionBitFields:      "BI_BITFIELDS",
+	4:                         "BI_JPEG",
+	5:                         "BI_PNG",
+	compressionAlphaBitFields: "BI_ALPHABITFIELDS",
+}
+
+var headerNames = map[uint32]string{
+	12:  "BITMAPCOREHEADER",
+	40:  "BITMAPINFOHEADER",
+	52:  "BITMAPV2INFOHEADER",
+	56:  "BITMAPV3INFOHEADER",
+	64:  "OS22XBITMAPHEADER",
+	108: "BITMAPV4HEADER",
+	124: "BITMAPV5HEADER",
+}
+
+// maxPixels limits the size of the images that are decoded, so a bad header can't use up all memory
+const maxPixels = 1 << 28
+
+// Header holds the fields of a BMP file header and bitmap information header
+type Header struct {
+	FileSize        uint32
+	PixelOffset     uint32
+	HeaderSize      uint32
+	Width           int32
+	Height          int32 // negative for images stored from the top row down
+	Planes          uint16
+	BitsPerPixel    uint16
+	Compression     uint32
+	ImageSize       uint32
+	XPixelsPerMeter int32
+	YPixelsPerMeter int32
+	ColorsUsed      uint32
+	ColorsImportant uint32
+	// the masks are set for 16 and 32-bit images, using the defaults if the file doesn't have any
+	RedMask, GreenMask, BlueMask, AlphaMask uint32
+	Palette                                 color.Palette
+	// length is the number of bytes read, up to the end of the palette
+	length int
+}
+
+// DecodeHeader reads the headers and palette of a BMP image
+func DecodeHeader(r io.Reader) (Header, error) {
+	var h Header
+	le := binary.LittleEndian
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		h.length += n
+		return b, err
+	}
+
+	b, err := read(18)
+	if err != nil {
+		return h, err
+	}
+	if string(b[:2]) != "BM" {
+		return h, errors.New("bmp: not a BMP file")
+	}
+	h.FileSize = le.Uint32(b[2:])
+	h.PixelOffset = le.Uint32(b[10:])
+	h.HeaderSize = le.Uint32(b[14:])
+	if h.HeaderSize < 12 || h.HeaderSize > 1024 || (h.HeaderSize > 12 && h.HeaderSize < 40) {
+		return h, fmt.Errorf("bmp: bad header size %d", h.HeaderSize)
+	}
+	if b, err = read(int(h.HeaderSize) - 4); err != nil {
+		return h, err
+	}
+	paletteEntry := 4
+	if h.HeaderSize == 12 {
+		h.Width = int32(int16(le.Uint16(b)))
+		h.Height = int32(int16(le.Uint16(b[2:])))
+		h.Planes = le.Uint16(b[4:])
+		h.BitsPerPixel = le.Uint16(b[6:])
+		paletteEntry = 3
+	} else {
+		h.Width = int32(le.Uint32(b))
+		h.Height = int32(le.Uint32(b[4:]))
+		h.Planes = le.Uint16(b[8:])
+		h.BitsPerPixel = le.Uint16(b[10:])
+		h.Compression = le.Uint32(b[12:])
+		h.ImageSize = le.Uint32(b[16:])
+		h.XPixelsPerMeter = int32(le.Uint32(b[20:]))
+		h.YPixelsPerMeter = int32(le.Uint32(b[24:]))
+		h.ColorsUsed = le.Uint32(b[28:])
+		h.ColorsImportant = le.Uint32(b[32:])
+	}
+
+	bitFields := h.Compression == compressionBitFields || h.Compression == compressionAlphaBitFields
+	switch {
+	case !bitFields:
+	case h.HeaderSize >= 56:
+		h.RedMask, h.GreenMask, h.BlueMask, h.AlphaMask = le.Uint32(b[36:]), le.Uint32(b[40:]), le.Uint32(b[44:]), le.Uint32(b[48:])
+	case h.HeaderSize >= 52:
+		h.RedMask, h.GreenMask, h.BlueMask = le.Uint32(b[36:]), le.Uint32(b[40:]), le.Uint32(b[44:])
+	default:
+		// the masks follow a BITMAPINFOHEADER
+		n := 12
+		if h.Compression == compressionAlphaBitFields {
+			n = 16
+		}
+		m, err := read(n)
+		if err != nil {
+			return h, err
+		}
+		h.RedMask, h.GreenMask, h.BlueMask = le.Uint32(m), le.Uint32(m[4:]), le.Uint32(m[8:])
+		if n == 16 {
+			h.AlphaMask = le.Uint32(m[12:])
+		}
+	}
+	if !bitFields {
+		switch h.BitsPerPixel {
+		case 16:
+			h.RedMask, h.GreenMask, h.BlueMask = 0x7c00, 0x03e0, 0x001f
+		case 32:
+			h.RedMask, h.GreenMask, h.BlueMask = 0xff0000, 0x00ff00, 0x0000ff
+		}
+	}
+
+	if err := h.check(); err != nil {
+		return h, err
+	}
+
+	if h.BitsPerPixel <= 8 {
+		n := 1 << h.BitsPerPixel
+		if h.ColorsUsed > 0 && int(h.ColorsUsed) < n {
+			n = int(h.ColorsUsed)
+		}
+		p, err := read(n * paletteEntry)
+		if err != nil {
+			return h, err
+		}
+		for i := 0; i < n; i++ {
+			e := p[i*paletteEntry:]
+			h.Palette = append(h.Palette, color.RGBA{e[2], e[1], e[0], 0xff})
+		}
+	}
+	return h, nil
+}
+
+// check returns an error if the image can't be decoded
+func (h Header) check() error {
+	height := int(h.Height)
+	if height < 0 {
+		height = -height
+	}
+	if h.Width < 1 || height < 1 || int(h.Width)*height > maxPixels {
+		return fmt.Errorf("bmp: bad size %dx%d", h.Width, h.Height)
+	}
+	switch h.Compression {
+	case compressionRGB:
+		switch h.BitsPerPixel {
+		case 1, 4, 8, 16, 24, 32:
+			return nil
+		}
+	case compressionRLE8:
+		if h.BitsPerPixel == 8 && h.Height > 0 {
+			return nil
+		}
+	case compressionRLE4:
+		if h.BitsPerPixel == 4 && h.Height > 0 {
+			return nil
+		}
+	case compressionBitFields, compressionAlphaBitFields:
+		if h.BitsPerPixel == 16 || h.BitsPerPixel == 32 {
+			return nil
+		}
+	}
+	return fmt.Errorf("bmp: %d bits per pixel with %s compression isn't supported", h.BitsPerPixel, h.compressionName())
+}
+
+func (h Header) compressionName() string {
+	if name, ok := compressionNames[h.Compression]; ok {
+		return name
+	}
+	return strconv.Itoa(int(h.Compression))
+}
+
+func (h Header) colorModel() color.Model {
+	if h.BitsPerPixel <= 8 {
+		return h.palette()
+	}
+	return color.NRGBAModel
+}
+
+// palette returns the palette with enough entries for every index, which are black if they are missing
+func (h Header) palette() color.Palette {
+	p := append(color.Palette(nil), h.Palette...)
+	for len(p) < 1<<h.BitsPerPixel {
+		p = append(p, color.RGBA{0, 0, 0, 0xff})
+	}
+	return p
+}
+
+// Fields returns the header fields in the order they are stored
+func (h Header) Fields() []greyscale.HeaderField {
+	order := "bottom-up"
+	if h.Height < 0 {
+		order = "top-down"
+	}
+	name := headerNames[h.HeaderSize]
+	if name == "" {
+		name = "unknown"
+	}
+	dpi := func(ppm int32) string { return fmt.Sprintf("%.0f dpi", float64(ppm)*0.0254) }
+	fields := []greyscale.HeaderField{
+		{Name: "File Size", Value: strconv.Itoa(int(h.FileSize)), Comment: "bytes"},
+		{Name: "Pixel Data Offset", Value: strconv.Itoa(int(h.PixelOffset))},
+		{Name: "Header Size", Value: strconv.Itoa(int(h.HeaderSize)), Comment: name},
+		{Name: "Width", Value: strconv.Itoa(int(h.Width))},
+		{Name: "Height", Value: strconv.Itoa(int(h.Height)), Comment: order},
+		{Name: "Planes", Value: strconv.Itoa(int(h.Planes))},
+		{Name: "Bits Per Pixel", Value: strconv.Itoa(int(h.BitsPerPixel))},
+		{Name: "Compression", Value: h.compressionName()},
+	}
+	if h.HeaderSize > 12 {
+		fields = append(fields,
+			greyscale.HeaderField{Name: "Image Size", Value: strconv.Itoa(int(h.ImageSize)), Comment: "bytes"},
+			greyscale.HeaderField{Name: "X Pixels Per Meter", Value: strconv.Itoa(int(h.XPixelsPerMeter)), Comment: dpi(h.XPixelsPerMeter)},
+			greyscale.HeaderField{Name: "Y Pixels Per Meter", Value: strconv.Itoa(int(h.YPixelsPerMeter)), Comment: dpi(h.YPixelsPerMeter)},
+			greyscale.HeaderField{Name: "Colors Used", Value: strconv.Itoa(int(h.ColorsUsed))},
+			greyscale.HeaderField{Name: "Important Colors", Value: strconv.Itoa(int(h.ColorsImportant))},
+		)
+	}
+	if h.BitsPerPixel == 16 || h.BitsPerPixel == 32 {
+		mask := func(m uint32) string { return fmt.Sprintf("0x%08x", m) }
+		fields = append(fields,
+			greyscale.HeaderField{Name: "Red Mask", Value: mask(h.RedMask)},
+			greyscale.HeaderField{Name: "Green Mask", Value: mask(h.GreenMask)},
+			greyscale.HeaderField{Name: "Blue Mask", Value: mask(h.BlueMask)},
+			greyscale.HeaderField{Name: "Alpha Mask", Value: mask(h.AlphaMask)},
+		)
+	}
+	if len(h.Palette) > 0 {
+		comment := "color"
+		if greyPalette(h.Palette) {
+			comment = "grey"
+		}
+		fields = append(fields, greyscale.HeaderField{Name: "Palette Entries", Value: strconv.Itoa(len(h.Palette)), Comment: comment})
+	}
+	return fields
+}
+
+// greyPalette returns true if every color of p is a neutral grey
+func greyPalette(p color.Palette) bool {
+	for _, c := range p {
+		rgba := c.(color.RGBA)
+		if rgba.R != rgba.G || rgba.G != rgba.B {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeConfig returns the color model and dimensions of a BMP image without decoding it
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := DecodeHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	height := int(h.Height)
+	if height < 0 {
+		height = -height
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: int(h.Width), Height: height}, nil
+}
+
+// Decode reads a BMP image. Images with a palette become an *image.Paletted,
+// and the others become an *image.NRGBA.
+func Decode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := DecodeHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	// skip any gap between the palette and the pixels
+	if gap := int(h.PixelOffset) - h.length; gap > 0 {
+		if _, err := br.Discard(gap); err != nil {
+			return nil, unexpected(err)
+		}
+	}
+
+	width, height := int(h.Width), int(h.Height)
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	// rows are stored from the bottom up, unless the height is negative
+	row := func(i int) int {
+		if topDown {
+			return i
+		}
+		return height - 1 - i
+	}
+	bounds := image.Rect(0, 0, width, height)
+
+	if h.Compression == compressionRLE8 || h.Compression == compressionRLE4 {
+		m := image.NewPaletted(bounds, h.palette())
+		if err := decodeRLE(br, m, h.Compression == compressionRLE4); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	bpp := int(h.BitsPerPixel)
+	buf := make([]byte, (width*bpp+31)/32*4)
+	if bpp <= 8 {
+		m := image.NewPaletted(bounds, h.palette())
+		for i := 0; i < height; i++ {
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return nil, unexpected(err)
+			}
+			pix := m.Pix[row(i)*m.Stride:]
+			for x := 0; x < width; x++ {
+				// pixels are packed high bits first
+				bit := x * bpp
+				pix[x] = buf[bit/8] >> (8 - bpp - bit%8) & (1<<bpp - 1)
+			}
+		}
+		return m, nil
+	}
+
+	m := image.NewNRGBA(bounds)
+	channels := [4]channel{newChannel(h.RedMask), newChannel(h.GreenMask), newChannel(h.BlueMask), newChannel(h.AlphaMask)}
+	anyAlpha := false
+	for i := 0; i < height; i++ {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, unexpected(err)
+		}
+		pix := m.Pix[row(i)*m.Stride:]
+		for x := 0; x < width; x++ {
+			p := pix[x*4 : x*4+4]
+			switch bpp {
+			case 24:
+				p[0], p[1], p[2], p[3] = buf[x*3+2], buf[x*3+1], buf[x*3], 0xff
+				continue
+			case 16:
+				v := uint32(binary.LittleEndian.Uint16(buf[x*2:]))
+				p[0], p[1], p[2], p[3] = channels[0].get(v), channels[1].get(v), channels[2].get(v), channels[3].get(v)
+			case 32:
+				v := binary.LittleEndian.Uint32(buf[x*4:])
+				p[0], p[1], p[2], p[3] = channels[0].get(v), channels[1].get(v), channels[2].get(v), channels[3].get(v)
+			}
+			anyAlpha = anyAlpha || p[3] != 0
+		}
+	}
+	if bpp != 24 && !anyAlpha {
+		// without an alpha mask, or if every alpha value is 0, the image is opaque
+		for i := 3; i < len(m.Pix); i += 4 {
+			m.Pix[i] = 0xff
+		}
+	}
+	return m, nil
+}
+
+// channel extracts one channel from a pixel with a bit mask
+type channel struct {
+	mask, shift, max uint32
+}
+
+func newChannel(mask uint32) channel {
+	if mask == 0 {
+		return channel{}
+	}
+	shift := uint32(bits.TrailingZeros32(mask))
+	return channel{mask, shift, mask >> shift}
+}
+
+// get returns the channel's value in pixel v, scaled to 0-255
+func (c channel) get(v uint32) uint8 {
+	if c.max == 0 {
+		return 0
+	}
+	return uint8((uint64(v&c.mask>>c.shift)*255 + uint64(c.max)/2) / uint64(c.max))
+}
+
+// decodeRLE reads RLE8 or RLE4 compressed pixels into m, from the bottom row up.
+// Pixels that are skipped over keep index 0.
+func decodeRLE(r io.ByteReader, m *image.Paletted, rle4 bool) error {
+	width, height := m.Bounds().Dx(), m.Bounds().Dy()
+	x, y := 0, height-1
+	next := func() (int, error) {
+		b, err := r.ReadByte()
+		return int(b), unexpected(err)
+	}
+	set := func(i int) {
+		if x < width && y >= 0 {
+			m.Pix[y*m.Stride+x] = uint8(i)
+		}
+		x++
+	}
+	for {
+		n, err := next()
+		if err != nil {
+			return err
+		}
+		v, err := next()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			// a run of n pixels, which alternate between the two halves of v for RLE4
+			for i := 0; i < n; i++ {
+				switch {
+				case !rle4:
+					set(v)
+				case i%2 == 0:
+					set(v >> 4)
+				default:
+					set(v & 0x0f)
+				}
+			}
+			continue
+		}
+		switch v {
+		case 0: // end of line
+			x, y = 0, y-1
+		case 1: // end of bitmap
+			return nil
+		case 2: // move right and up
+			dx, err := next()
+			if err != nil {
+				return err
+			}
+			dy, err := next()
+			if err != nil {
+				return err
+			}
+			x, y = x+dx, y-dy
+		default:
+			// v pixels stored as they are, padded to an even number of bytes
+			size := v
+			if rle4 {
+				size = (v + 1) / 2
+			}
+			for i := 0; i < size; i++ {
+				b, err := next()
+				if err != nil {
+					return err
+				}
+				if !rle4 {
+					set(b)
+					continue
+				}
+				set(b >> 4)
+				if 2*i+1 < v {
+					set(b & 0x0f)
+				}
+			}
+			if size%2 == 1 {
+				if _, err := next(); err != nil {
+					return err
+				}
+			}
+		}
+		if y < 0 {
+			return nil
+		}
+	}
+}
+
+// unexpected reports a file that ends too soon as a format error
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,315 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// testHeader describes a BMP file for bmpFile to make
+type testHeader struct {
+	size        int // 12, 40, 52, 56, 108 or 124, or 0 for 40
+	width       int
+	height      int // negative for top-down images
+	bpp         int
+	compression uint32
+	colorsUsed  int
+	// masks are written after a 40-byte header, or inside a larger one
+	masks   []uint32
+	palette []color.RGBA
+}
+
+// bmpFile makes a BMP file with the given pixel data
+func bmpFile(h testHeader, pixels []byte) []byte {
+	le := binary.LittleEndian
+	if h.size == 0 {
+		h.size = 40
+	}
+	info := make([]byte, h.size)
+	le.PutUint32(info, uint32(h.size))
+	if h.size == 12 {
+		le.PutUint16(info[4:], uint16(h.width))
+		le.PutUint16(info[6:], uint16(h.height))
+		le.PutUint16(info[8:], 1)
+		le.PutUint16(info[10:], uint16(h.bpp))
+	} else {
+		le.PutUint32(info[4:], uint32(int32(h.width)))
+		le.PutUint32(info[8:], uint32(int32(h.height)))
+		le.PutUint16(info[12:], 1)
+		le.PutUint16(info[14:], uint16(h.bpp))
+		le.PutUint32(info[16:], h.compression)
+		le.PutUint32(info[20:], uint32(len(pixels)))
+		le.PutUint32(info[24:], 2835)
+		le.PutUint32(info[28:], 2835)
+		le.PutUint32(info[32:], uint32(h.colorsUsed))
+	}
+	if h.size > 40 {
+		for i, m := range h.masks {
+			le.PutUint32(info[40+i*4:], m)
+		}
+	} else {
+		for _, m := range h.masks {
+			info = le.AppendUint32(info, m)
+		}
+	}
+	for _, c := range h.palette {
+		info = append(info, c.B, c.G, c.R)
+		if h.size != 12 {
+			info = append(info, 0)
+		}
+	}
+
+	file := []byte("BM")
+	file = le.AppendUint32(file, uint32(14+len(info)+len(pixels)))
+	file = le.AppendUint32(file, 0)
+	file = le.AppendUint32(file, uint32(14+len(info)))
+	file = append(file, info...)
+	return append(file, pixels...)
+}
+
+// rows packs the pixels of an image, given from the top row down, into padded rows
+// stored from the bottom up, or from the top down if topDown is true.
+// Pixels are palette indexes, or 0xRRGGBB for 24-bit images.
+func rows(bpp int, topDown bool, pixels [][]uint32) []byte {
+	var out []byte
+	for i := range pixels {
+		p := pixels[len(pixels)-1-i]
+		if topDown {
+			p = pixels[i]
+		}
+		row := make([]byte, (len(p)*bpp+31)/32*4)
+		for x, v := range p {
+			switch bpp {
+			case 1, 4, 8:
+				bit := x * bpp
+				row[bit/8] |= byte(v) << (8 - bpp - bit%8)
+			case 16:
+				binary.LittleEndian.PutUint16(row[x*2:], uint16(v))
+			case 24:
+				row[x*3], row[x*3+1], row[x*3+2] = byte(v), byte(v>>8), byte(v>>16)
+			case 32:
+				binary.LittleEndian.PutUint32(row[x*4:], v)
+			}
+		}
+		out = append(out, row...)
+	}
+	return out
+}
+
+// greys returns a palette of n greys, step apart
+func greys(n, step int) []color.RGBA {
+	var p []color.RGBA
+	for i := 0; i < n; i++ {
+		v := uint8(i * step)
+		p = append(p, color.RGBA{v, v, v, 0xff})
+	}
+	return p
+}
+
+// rgba turns the rows of palette indexes of a greys palette into 0xRRGGBBAA colors
+func rgba(step int, pixels [][]uint32) [][]uint32 {
+	var out [][]uint32
+	for _, row := range pixels {
+		var r []uint32
+		for _, i := range row {
+			v := uint32(uint8(int(i) * step))
+			r = append(r, v<<24|v<<16|v<<8|0xff)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestDecode(t *testing.T) {
+	indexes := [][]uint32{{0, 1, 2}, {3, 1, 0}}
+	bits := [][]uint32{{1, 0, 1}, {0, 1, 1}}
+	bw := []color.RGBA{{0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	rgb := [][]uint32{{0xff0000, 0x00ff00, 0x0000ff}, {0x112233, 0xffffff, 0x000000}}
+	want := [][]uint32{{0xff0000ff, 0x00ff00ff, 0x0000ffff}, {0x112233ff, 0xffffffff, 0x000000ff}}
+
+	tests := []struct {
+		name string
+		data []byte
+		want [][]uint32 // 0xRRGGBBAA, from the top row down
+	}{
+		{"1-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 1, palette: bw}, rows(1, false, bits)), rgba(255, bits)},
+		{
+			// a row of 17 pixels takes three bytes, plus one byte of padding
+			"1-bit wide",
+			bmpFile(testHeader{width: 17, height: 1, bpp: 1, palette: bw}, rows(1, false, [][]uint32{{1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}})),
+			rgba(255, [][]uint32{{1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1}}),
+		},
+		{"4-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 4, palette: greys(16, 17)}, rows(4, false, indexes)), rgba(17, indexes)},
+		{"8-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 8, palette: greys(256, 1)}, rows(8, false, indexes)), rgba(1, indexes)},
+		{
+			// index 3 is past the end of the palette, so it's black
+			"8-bit short palette",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 8, colorsUsed: 3, palette: greys(3, 100)}, rows(8, false, indexes)),
+			[][]uint32{{0x000000ff, 0x646464ff, 0xc8c8c8ff}, {0x000000ff, 0x646464ff, 0x000000ff}},
+		},
+		{"8-bit top-down", bmpFile(testHeader{width: 3, height: -2, bpp: 8, palette: greys(256, 1)}, rows(8, true, indexes)), rgba(1, indexes)},
+		{"8-bit OS/2", bmpFile(testHeader{size: 12, width: 3, height: 2, bpp: 8, palette: greys(256, 1)}, rows(8, false, indexes)), rgba(1, indexes)},
+		{
+			"16-bit",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 16}, rows(16, false, [][]uint32{{0x7c00, 0x03e0, 0x001f}, {0x0000, 0x7fff, 0x4210}})),
+			[][]uint32{{0xff0000ff, 0x00ff00ff, 0x0000ffff}, {0x000000ff, 0xffffffff, 0x848484ff}},
+		},
+		{
+			"16-bit 565",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 16, compression: compressionBitFields, masks: []uint32{0xf800, 0x07e0, 0x001f}},
+				rows(16, false, [][]uint32{{0xf800, 0x07e0, 0x001f}, {0x0000, 0xffff, 0x0000}})),
+			[][]uint32{{0xff0000ff, 0x00ff00ff, 0x0000ffff}, {0x000000ff, 0xffffffff, 0x000000ff}},
+		},
+		{"24-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 24}, rows(24, false, rgb)), want},
+		{"24-bit top-down", bmpFile(testHeader{width: 3, height: -2, bpp: 24}, rows(24, true, rgb)), want},
+		{"32-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 32}, rows(32, false, rgb)), want},
+		{
+			"32-bit alpha",
+			bmpFile(testHeader{size: 108, width: 3, height: 2, bpp: 32, compression: compressionBitFields, masks: []uint32{0xff0000, 0xff00, 0xff, 0xff000000}},
+				rows(32, false, [][]uint32{{0xffff0000, 0x8000ff00, 0x000000ff}, {0xff112233, 0xffffffff, 0xff000000}})),
+			[][]uint32{{0xff0000ff, 0x00ff0080, 0x0000ff00}, {0x112233ff, 0xffffffff, 0x000000ff}},
+		},
+		{
+			// an alpha mask with every alpha value 0 is ignored
+			"32-bit zero alpha",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 32, compression: compressionAlphaBitFields, masks: []uint32{0xff0000, 0xff00, 0xff, 0xff000000}},
+				rows(32, false, rgb)),
+			want,
+		},
+		{
+			// the bottom row is stored as it is, and the top row as a run
+			"RLE8",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 8, compression: compressionRLE8, palette: greys(256, 1)},
+				[]byte{0, 3, 2, 3, 4, 0, 0, 0, 3, 1, 0, 1}),
+			rgba(1, [][]uint32{{1, 1, 1}, {2, 3, 4}}),
+		},
+		{
+			// a delta moves one pixel right and one row up, leaving the skipped pixels at index 0
+			"RLE8 delta",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 8, compression: compressionRLE8, palette: greys(256, 1)},
+				[]byte{0, 2, 1, 1, 2, 5, 0, 1}),
+			rgba(1, [][]uint32{{0, 5, 5}, {0, 0, 0}}),
+		},
+		{
+			"RLE4",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 4, compression: compressionRLE4, palette: greys(16, 17)},
+				[]byte{3, 0x12, 0, 0, 0, 3, 0x34, 0x50, 0, 1}),
+			rgba(17, [][]uint32{{3, 4, 5}, {1, 2, 1}}),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Decode(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := m.Bounds()
+			if b.Dx() != len(tc.want[0]) || b.Dy() != len(tc.want) {
+				t.Fatalf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), len(tc.want[0]), len(tc.want))
+			}
+			for y, row := range tc.want {
+				for x, v := range row {
+					want := color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+					if got := color.NRGBAModel.Convert(m.At(x, y)); got != want {
+						t.Errorf("pixel %d,%d is %v, want %v", x, y, got, want)
+					}
+				}
+			}
+
+			cfg, err := DecodeConfig(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != b.Dx() || cfg.Height != b.Dy() {
+				t.Errorf("config is %dx%d, want %dx%d", cfg.Width, cfg.Height, b.Dx(), b.Dy())
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	pixels := rows(8, false, [][]uint32{{0, 1, 2}, {3, 1, 0}})
+	badHeaderSize := bmpFile(testHeader{width: 3, height: 2, bpp: 8, palette: greys(256, 1)}, pixels)
+	binary.LittleEndian.PutUint32(badHeaderSize[14:], 20)
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not BMP", []byte("GIF89a and some more bytes"), "not a BMP"},
+		{"bad header size", badHeaderSize, "bad header size"},
+		{"bad size", bmpFile(testHeader{width: 0, height: 2, bpp: 8, palette: greys(256, 1)}, pixels), "bad size"},
+		{"bad bits per pixel", bmpFile(testHeader{width: 3, height: 2, bpp: 7}, pixels), "7 bits per pixel"},
+		{"RLE8 24-bit", bmpFile(testHeader{width: 3, height: 2, bpp: 24, compression: compressionRLE8}, pixels), "BI_RLE8 compression"},
+		{
+			"RLE8 top-down",
+			bmpFile(testHeader{width: 3, height: -2, bpp: 8, compression: compressionRLE8, palette: greys(256, 1)}, []byte{0, 1}),
+			"BI_RLE8 compression",
+		},
+		{"JPEG", bmpFile(testHeader{width: 3, height: 2, bpp: 24, compression: 4}, pixels), "BI_JPEG"},
+		{"short pixels", bmpFile(testHeader{width: 3, height: 2, bpp: 8, palette: greys(256, 1)}, pixels[:6]), "unexpected EOF"},
+		{
+			"RLE8 without an end",
+			bmpFile(testHeader{width: 3, height: 2, bpp: 8, compression: compressionRLE8, palette: greys(256, 1)}, []byte{3, 1}),
+			"unexpected EOF",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error is %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestHeaderFields(t *testing.T) {
+	data := bmpFile(testHeader{width: 3, height: -2, bpp: 8, palette: greys(256, 1)}, rows(8, true, [][]uint32{{0, 1, 2}, {3, 1, 0}}))
+	h, err := DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for _, f := range h.Fields() {
+		fields[f.Name] = f.Value + " " + f.Comment
+	}
+	for name, want := range map[string]string{
+		"Header Size":        "40 BITMAPINFOHEADER",
+		"Height":             "-2 top-down",
+		"Bits Per Pixel":     "8 ",
+		"Compression":        "BI_RGB ",
+		"X Pixels Per Meter": "2835 72 dpi",
+		"Palette Entries":    "256 grey",
+	} {
+		if fields[name] != want {
+			t.Errorf("%s is %q, want %q", name, fields[name], want)
+		}
+	}
+	if _, ok := fields["Red Mask"]; ok {
+		t.Errorf("an 8-bit image has a Red Mask field")
+	}
+}
@@ -0,0 +1,457 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package fits decodes the images in FITS (Flexible Image Transport System) files,
+// as used in astronomy.
+//
+// It reads the first image in a file, from the primary header and data unit or an IMAGE
+// extension, with BITPIX 8, 16, 32, 64, -32 or -64 and BZERO/BSCALE scaling. The values are
+// stretched onto 16-bit greys (see Stretch). Images with a third axis, such as data cubes,
+// have a page for each plane. Importing the package registers the decoder with the image package,
+// like image/png does.
+package fits
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+)
+
+func init() {
+	image.RegisterFormat("fits", "SIMPLE  =", Decode, DecodeConfig)
+	greyscale.RegisterPageDecoder("fits", DecodePages)
+	greyscale.RegisterHeaderReader("fits", func(r io.Reader) ([]greyscale.HeaderField, error) {
+		h, err := DecodeHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		return h.Fields(), nil
+	})
+}
+
+const (
+	blockSize = 2880
+	cardSize  = 80
+)
+
+// maxPixels limits the size of the images that are decoded, so a bad header can't use up all memory
+const maxPixels = 1 << 28
+
+// maxPages limits the number of planes, so a bad header can't make a huge list of pages
+const maxPages = 1 << 16
+
+// Card is one keyword record of a FITS header
+type Card struct {
+	Key     string
+	Value   string
+	Comment string
+}
+
+// Header is the list of cards of the header of the first image in a FITS file
+type Header []Card
+
+// get returns the value of a keyword, with the quotes removed from strings
+func (h Header) get(key string) (string, bool) {
+	for _, c := range h {
+		if c.Key == key {
+			return c.Value, true
+		}
+	}
+	return "", false
+}
+
+// int returns the integer value of a keyword, or def if it isn't there
+func (h Header) int(key string, def int) (int, error) {
+	v, ok := h.get(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("fits: %s is not an integer: %q", key, v)
+	}
+	return n, nil
+}
+
+// float returns the floating point value of a keyword, or def if it isn't there
+func (h Header) float(key string, def float64) (float64, error) {
+	v, ok := h.get(key)
+	if !ok {
+		return def, nil
+	}
+	// Fortran-style exponents use D instead of E
+	f, err := strconv.ParseFloat(strings.Replace(strings.ToUpper(v), "D", "E", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("fits: %s is not a number: %q", key, v)
+	}
+	return f, nil
+}
+
+// Fields returns the cards of the header, without the END card
+func (h Header) Fields() []greyscale.HeaderField {
+	var fields []greyscale.HeaderField
+	for _, c := range h {
+		fields = append(fields, greyscale.HeaderField{Name: c.Key, Value: c.Value, Comment: c.Comment})
+	}
+	return fields
+}
+
+// parseCard splits an 80-character card into its keyword, value and comment
+func parseCard(card string) Card {
+	c := Card{Key: strings.TrimSpace(card[:8])}
+	if card[8:10] != "= " {
+		// COMMENT, HISTORY and blank keywords have text instead of a value
+		c.Value = strings.TrimSpace(card[8:])
+		return c
+	}
+	rest := strings.TrimSpace(card[10:])
+	if strings.HasPrefix(rest, "'") {
+		// a string, where '' is a quote
+		var s strings.Builder
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] == '\'' {
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					s.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			s.WriteByte(rest[i])
+		}
+		c.Value = strings.TrimRight(s.String(), " ")
+		rest = rest[min(i+1, len(rest)):]
+	} else {
+		value, _, _ := strings.Cut(rest, "/")
+		c.Value = strings.TrimSpace(value)
+		rest = rest[len(value):]
+	}
+	if _, comment, ok := strings.Cut(rest, "/"); ok {
+		c.Comment = strings.TrimSpace(comment)
+	}
+	return c
+}
+
+// hdu is a header and data unit
+type hdu struct {
+	header Header
+	bitpix int
+	axes   []int
+}
+
+// readHDU reads the header of the next header and data unit
+func readHDU(r io.Reader) (*hdu, error) {
+	block := make([]byte, blockSize)
+	u := &hdu{}
+	for end := false; !end; {
+		if _, err := io.ReadFull(r, block); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("fits: header: %w", err)
+		}
+		for i := 0; i < blockSize; i += cardSize {
+			card := string(block[i : i+cardSize])
+			if strings.TrimSpace(card[:8]) == "END" {
+				end = true
+				break
+			}
+			if strings.TrimSpace(card) == "" {
+				continue
+			}
+			u.header = append(u.header, parseCard(card))
+		}
+		if len(u.header) > 100000 {
+			return nil, errors.New("fits: header has no END")
+		}
+	}
+
+	var err error
+	if u.bitpix, err = u.header.int("BITPIX", 0); err != nil {
+		return nil, err
+	}
+	switch u.bitpix {
+	case 8, 16, 32, 64, -32, -64:
+	default:
+		return nil, fmt.Errorf("fits: bad BITPIX %d", u.bitpix)
+	}
+	naxis, err := u.header.int("NAXIS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if naxis < 0 || naxis > 999 {
+		return nil, fmt.Errorf("fits: bad NAXIS %d", naxis)
+	}
+	for i := 1; i <= naxis; i++ {
+		n, err := u.header.int(fmt.Sprintf("NAXIS%d", i), 0)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > maxPixels {
+			return nil, fmt.Errorf("fits: bad NAXIS%d %d", i, n)
+		}
+		u.axes = append(u.axes, n)
+	}
+	return u, nil
+}
+
+// isImage returns true if the unit holds an image with at least two axes
+func (u *hdu) isImage() bool {
+	if len(u.axes) < 2 || u.axes[0] == 0 || u.axes[1] == 0 {
+		return false
+	}
+	if x, ok := u.header.get("XTENSION"); ok && x != "IMAGE" {
+		return false
+	}
+	return true
+}
+
+// dataSize returns the number of bytes of data that follow the header, including padding
+func (u *hdu) dataSize() (int64, error) {
+	if len(u.axes) == 0 {
+		return 0, nil
+	}
+	pcount, err := u.header.int("PCOUNT", 0)
+	if err != nil {
+		return 0, err
+	}
+	gcount, err := u.header.int("GCOUNT", 1)
+	if err != nil {
+		return 0, err
+	}
+	n := int64(1)
+	for _, a := range u.axes {
+		n *= int64(a)
+		if n > 1<<40 {
+			return 0, errors.New("fits: data is too large")
+		}
+	}
+	size := int64(abs(u.bitpix)/8) * int64(gcount) * (int64(pcount) + n)
+	return (size + blockSize - 1) / blockSize * blockSize, nil
+}
+
+// planes returns the number of planes of the image, which is 1 for a 2D image.
+// It returns an error if there are no planes, or more than maxPages.
+func (u *hdu) planes() (int, error) {
+	n := 1
+	for i, a := range u.axes[2:] {
+		if a == 0 {
+			return 0, fmt.Errorf("fits: the image has no planes, because NAXIS%d is 0", i+3)
+		}
+		if n > maxPages/a {
+			return 0, fmt.Errorf("fits: the image has more than %d planes", maxPages)
+		}
+		n *= a
+	}
+	return n, nil
+}
+
+// firstImage reads headers until it finds the first image, and leaves r at the start of its data
+func firstImage(r *bufio.Reader) (*hdu, error) {
+	for {
+		u, err := readHDU(r)
+		if err == io.EOF {
+			return nil, errors.New("fits: the file has no image")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u.isImage() {
+			if u.axes[0]*u.axes[1] > maxPixels {
+				return nil, fmt.Errorf("fits: bad size %dx%d", u.axes[0], u.axes[1])
+			}
+			if _, err := u.planes(); err != nil {
+				return nil, err
+			}
+			return u, nil
+		}
+		size, err := u.dataSize()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return nil, fmt.Errorf("fits: data: %w", err)
+		}
+	}
+}
+
+// DecodeHeader returns the header of the first image in a FITS file
+func DecodeHeader(r io.Reader) (Header, error) {
+	u, err := firstImage(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	return u.header, nil
+}
+
+// DecodeConfig returns the dimensions of the first image in a FITS file
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	u, err := firstImage(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.Gray16Model, Width: u.axes[0], Height: u.axes[1]}, nil
+}
+
+// Decode reads the first plane of the first image in a FITS file, stretched with MinMax
+func Decode(r io.Reader) (image.Image, error) {
+	pages, _, err := DecodePages(r, []int{0})
+	if err != nil {
+		return nil, err
+	}
+	return pages[0], nil
+}
+
+// DecodePages reads the planes of the first image in a FITS file with the given indexes, counting
+// from 0, or every plane if pages is nil. Each plane is stretched separately with MinMax.
+// It also returns the number of planes.
+func DecodePages(r io.Reader, pages []int) ([]image.Image, int, error) {
+	return DecodeStretch(r, pages, MinMax)
+}
+
+// DecodeStretch is like DecodePages, but with a Stretch of its own.
+// The pages are *image.Gray16, with the first row of the data at the bottom. Blank or NaN
+// values are black, infinities are clipped, and a plane whose values are all the same is mid grey.
+func DecodeStretch(r io.Reader, pages []int, s Stretch) ([]image.Image, int, error) {
+	br := bufio.NewReader(r)
+	u, err := firstImage(br)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := u.planes()
+	if err != nil {
+		return nil, 0, err
+	}
+	if pages == nil {
+		for i := 0; i < n; i++ {
+			pages = append(pages, i)
+		}
+	}
+
+	bzero, err := u.header.float("BZERO", 0)
+	if err != nil {
+		return nil, n, err
+	}
+	bscale, err := u.header.float("BSCALE", 1)
+	if err != nil {
+		return nil, n, err
+	}
+	blank, hasBlank := u.header.get("BLANK")
+	blankValue, _ := strconv.ParseInt(blank, 10, 64)
+
+	width, height := u.axes[0], u.axes[1]
+	sampleSize := abs(u.bitpix) / 8
+	planeSize := width * height * sampleSize
+	buf := make([]byte, planeSize)
+	values := make([]float64, width*height)
+	var ret []image.Image
+	plane := 0
+	for _, p := range pages {
+		if p < 0 || p >= n {
+			return nil, n, fmt.Errorf("there is no page %d, the image has %d planes", p+1, n)
+		}
+		// planes are read in order, so an earlier one can't be read again
+		if p < plane {
+			return nil, n, errors.New("fits: pages must be in order")
+		}
+		if _, err := br.Discard((p - plane) * planeSize); err != nil {
+			return nil, n, fmt.Errorf("fits: data: %w", unexpected(err))
+		}
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, n, fmt.Errorf("fits: data: %w", unexpected(err))
+		}
+		plane = p + 1
+
+		for i := range values {
+			b := buf[i*sampleSize:]
+			var raw int64
+			var v float64
+			switch u.bitpix {
+			case 8:
+				raw = int64(b[0])
+			case 16:
+				raw = int64(int16(binary.BigEndian.Uint16(b)))
+			case 32:
+				raw = int64(int32(binary.BigEndian.Uint32(b)))
+			case 64:
+				raw = int64(binary.BigEndian.Uint64(b))
+			case -32:
+				v = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+			case -64:
+				v = math.Float64frombits(binary.BigEndian.Uint64(b))
+			}
+			if u.bitpix > 0 {
+				if hasBlank && raw == blankValue {
+					values[i] = math.NaN()
+					continue
+				}
+				v = float64(raw)
+			}
+			values[i] = bzero + bscale*v
+		}
+
+		lo, hi := s.limits(values)
+		m := image.NewGray16(image.Rect(0, 0, width, height))
+		for i, v := range values {
+			var grey uint16
+			switch {
+			case math.IsNaN(v):
+			case hi > lo:
+				grey = uint16(math.Round(math.Max(0, math.Min((v-lo)/(hi-lo), 1)) * 0xffff))
+			case v > hi:
+				grey = 0xffff
+			case v == lo:
+				// there's nothing to stretch between, so the one value is mid grey
+				grey = 0x8000
+			}
+			// FITS images start from the bottom row
+			x, y := i%width, height-1-i/width
+			m.SetGray16(x, y, color.Gray16{grey})
+		}
+		ret = append(ret, m)
+	}
+	return ret, n, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// unexpected reports a file that ends too soon as a format error
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,338 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package fits
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"testing"
+)
+
+// card makes a header card with a value that is already formatted, eg: 'text' or 16
+func card(key, value string) string {
+	return fmt.Sprintf("%-80s", fmt.Sprintf("%-8s= %20s", key, value))
+}
+
+// block pads b to a whole number of FITS blocks with pad
+func block(b []byte, pad byte) []byte {
+	for len(b)%blockSize != 0 {
+		b = append(b, pad)
+	}
+	return b
+}
+
+// unit makes a header and data unit from its cards and data
+func unit(cards []string, data []byte) []byte {
+	h := []byte(strings.Join(cards, "") + fmt.Sprintf("%-80s", "END"))
+	return append(block(h, ' '), block(data, 0)...)
+}
+
+// image2D returns the cards of a 3x2 primary image, plus any others
+func image2D(bitpix int, others ...string) []string {
+	return append([]string{
+		card("SIMPLE", "T"),
+		card("BITPIX", fmt.Sprint(bitpix)),
+		card("NAXIS", "2"),
+		card("NAXIS1", "3"),
+		card("NAXIS2", "2"),
+	}, others...)
+}
+
+// samples encodes raw values as big-endian samples with the given BITPIX
+func samples(bitpix int, values ...float64) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		switch bitpix {
+		case 8:
+			b.WriteByte(uint8(v))
+		case 16:
+			binary.Write(&b, binary.BigEndian, int16(v))
+		case 32:
+			binary.Write(&b, binary.BigEndian, int32(v))
+		case 64:
+			binary.Write(&b, binary.BigEndian, int64(v))
+		case -32:
+			binary.Write(&b, binary.BigEndian, float32(v))
+		case -64:
+			binary.Write(&b, binary.BigEndian, v)
+		}
+	}
+	return b.Bytes()
+}
+
+// greys returns the 16-bit greys of a decoded image, in reading order
+func greys(t *testing.T, m image.Image) []uint16 {
+	t.Helper()
+	g, ok := m.(*image.Gray16)
+	if !ok {
+		t.Fatalf("image is a %T, want *image.Gray16", m)
+	}
+	var ret []uint16
+	for y := 0; y < g.Rect.Dy(); y++ {
+		for x := 0; x < g.Rect.Dx(); x++ {
+			ret = append(ret, g.Gray16At(x, y).Y)
+		}
+	}
+	return ret
+}
+
+func sameGreys(t *testing.T, got, want []uint16) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("greys are %v, want %v", got, want)
+	}
+}
+
+// stretched are the greys of an image whose values are 0-5, stretched from 0 to 5.
+// The first row of the data, 0 1 2, is at the bottom.
+var stretched = []uint16{39321, 52428, 65535, 0, 13107, 26214}
+
+var nan, inf = math.NaN(), math.Inf(1)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []uint16
+	}{
+		{"BITPIX 8", unit(image2D(8), samples(8, 0, 1, 2, 3, 4, 5)), stretched},
+		{"BITPIX 16", unit(image2D(16), samples(16, 0, 1, 2, 3, 4, 5)), stretched},
+		{"BITPIX 32", unit(image2D(32), samples(32, 0, 1, 2, 3, 4, 5)), stretched},
+		{"BITPIX 64", unit(image2D(64), samples(64, 0, 1, 2, 3, 4, 5)), stretched},
+		{"BITPIX -32", unit(image2D(-32), samples(-32, 0, 1, 2, 3, 4, 5)), stretched},
+		{"BITPIX -64", unit(image2D(-64), samples(-64, 0, 1, 2, 3, 4, 5)), stretched},
+		{
+			"BZERO",
+			unit(image2D(16, card("BZERO", "32768")), samples(16, -32768, -32767, -32766, -32765, -32764, -32763)),
+			stretched,
+		},
+		{
+			"BSCALE",
+			unit(image2D(32, card("BSCALE", "1.0D-3")), samples(32, 0, 1000, 2000, 3000, 4000, 5000)),
+			stretched,
+		},
+		{
+			// the stretch is from 1 to 5, since the blank doesn't count
+			"BLANK",
+			unit(image2D(16, card("BLANK", "-1")), samples(16, -1, 1, 2, 3, 4, 5)),
+			[]uint16{32768, 49151, 65535, 0, 0, 16384},
+		},
+		{"NaN", unit(image2D(-64), samples(-64, nan, 1, 2, 3, 4, 5)), []uint16{32768, 49151, 65535, 0, 0, 16384}},
+		{
+			// infinities don't count towards the stretch, from 1 to 4, and are clipped
+			"infinity",
+			unit(image2D(-32), samples(-32, -inf, 1, 2, 3, 4, inf)),
+			[]uint16{43690, 65535, 65535, 0, 0, 21845},
+		},
+		{"flat", unit(image2D(16), samples(16, 7, 7, 7, 7, 7, 7)), []uint16{32768, 32768, 32768, 32768, 32768, 32768}},
+		{
+			"flat with NaN and infinity",
+			unit(image2D(-32), samples(-32, nan, 7, -inf, 7, 7, inf)),
+			[]uint16{32768, 32768, 65535, 0, 32768, 0},
+		},
+		{"all NaN", unit(image2D(-32), samples(-32, nan, nan, nan, nan, nan, nan)), []uint16{0, 0, 0, 0, 0, 0}},
+		{
+			"image extension",
+			append(
+				unit([]string{card("SIMPLE", "T"), card("BITPIX", "8"), card("NAXIS", "0"), card("EXTEND", "T")}, nil),
+				unit([]string{
+					card("XTENSION", "'IMAGE   '"),
+					card("BITPIX", "-32"),
+					card("NAXIS", "2"),
+					card("NAXIS1", "3"),
+					card("NAXIS2", "2"),
+					card("PCOUNT", "0"),
+					card("GCOUNT", "1"),
+				}, samples(-32, 0, 1, 2, 3, 4, 5))...,
+			),
+			stretched,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Decode(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameGreys(t, greys(t, m), tc.want)
+
+			cfg, err := DecodeConfig(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != 3 || cfg.Height != 2 || cfg.ColorModel != m.ColorModel() {
+				t.Errorf("config is %dx%d %v, want 3x2 %v", cfg.Width, cfg.Height, cfg.ColorModel, m.ColorModel())
+			}
+		})
+	}
+}
+
+func TestDecodeStretch(t *testing.T) {
+	data := unit(image2D(16), samples(16, 0, 1, 2, 3, 4, 5))
+	tests := []struct {
+		stretch string
+		want    []uint16
+	}{
+		{"minmax", stretched},
+		{"range:1,4", []uint16{43690, 65535, 65535, 0, 0, 21845}},
+		{"range:-5,5", []uint16{52428, 58982, 65535, 32768, 39321, 45875}},
+		{"percentile:50,100", []uint16{21845, 43690, 65535, 0, 0, 0}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.stretch, func(t *testing.T) {
+			s, err := ParseStretch(tc.stretch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages, n, err := DecodeStretch(bytes.NewReader(data), nil, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 || len(pages) != 1 {
+				t.Fatalf("got %d of %d pages, want 1 of 1", len(pages), n)
+			}
+			sameGreys(t, greys(t, pages[0]), tc.want)
+		})
+	}
+}
+
+func TestDecodePages(t *testing.T) {
+	cards := []string{
+		card("SIMPLE", "T"),
+		card("BITPIX", "16"),
+		card("NAXIS", "3"),
+		card("NAXIS1", "3"),
+		card("NAXIS2", "2"),
+		card("NAXIS3", "3"),
+	}
+	// each plane is stretched separately, so they all look the same, apart from the flat one
+	data := unit(cards, samples(16, 0, 1, 2, 3, 4, 5, 10, 11, 12, 13, 14, 15, 9, 9, 9, 9, 9, 9))
+	flat := []uint16{32768, 32768, 32768, 32768, 32768, 32768}
+
+	tests := []struct {
+		name  string
+		pages []int
+		want  [][]uint16
+		err   string
+	}{
+		{"all", nil, [][]uint16{stretched, stretched, flat}, ""},
+		{"first", []int{0}, [][]uint16{stretched}, ""},
+		{"last", []int{2}, [][]uint16{flat}, ""},
+		{"some", []int{0, 2}, [][]uint16{stretched, flat}, ""},
+		{"out of order", []int{1, 0}, nil, "in order"},
+		{"too many", []int{3}, nil, "there is no page 4"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pages, n, err := DecodePages(bytes.NewReader(data), tc.pages)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("error is %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 3 {
+				t.Errorf("the file has %d pages, want 3", n)
+			}
+			if len(pages) != len(tc.want) {
+				t.Fatalf("got %d pages, want %d", len(pages), len(tc.want))
+			}
+			for i, m := range pages {
+				sameGreys(t, greys(t, m), tc.want[i])
+			}
+		})
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	cards := image2D(8,
+		card("OBJECT", "'M31 it''s'"),
+		fmt.Sprintf("%-80s", "EXPTIME =                 30.5 / seconds"),
+		fmt.Sprintf("%-80s", "COMMENT   made for testing"),
+	)
+	h, err := DecodeHeader(bytes.NewReader(unit(cards, samples(8, 0, 1, 2, 3, 4, 5))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Card{
+		{"SIMPLE", "T", ""},
+		{"BITPIX", "8", ""},
+		{"NAXIS", "2", ""},
+		{"NAXIS1", "3", ""},
+		{"NAXIS2", "2", ""},
+		{"OBJECT", "M31 it's", ""},
+		{"EXPTIME", "30.5", "seconds"},
+		{"COMMENT", "made for testing", ""},
+	}
+	if fmt.Sprint(h) != fmt.Sprint(want) {
+		t.Errorf("header is %v, want %v", h, want)
+	}
+	if fields := h.Fields(); len(fields) != len(want) || fields[6].Comment != "seconds" {
+		t.Errorf("fields are %v", fields)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	// cube returns the cards of a 3x2 image with more axes of the given lengths
+	cube := func(axes ...string) []string {
+		cards := []string{card("SIMPLE", "T"), card("BITPIX", "8"), card("NAXIS", fmt.Sprint(2+len(axes))), card("NAXIS1", "3"), card("NAXIS2", "2")}
+		for i, a := range axes {
+			cards = append(cards, card(fmt.Sprintf("NAXIS%d", i+3), a))
+		}
+		return cards
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"bad BITPIX", unit(image2D(12), samples(8, 0, 1, 2, 3, 4, 5)), "bad BITPIX"},
+		{"no image", unit([]string{card("SIMPLE", "T"), card("BITPIX", "8"), card("NAXIS", "0")}, nil), "no image"},
+		{"short data", unit(image2D(16), nil)[:blockSize+4], "unexpected EOF"},
+		{"bad BZERO", unit(image2D(16, card("BZERO", "'zero'")), samples(16, 0, 1, 2, 3, 4, 5)), "BZERO is not a number"},
+		{"no planes", unit(cube("0"), nil), "no planes, because NAXIS3 is 0"},
+		{"no planes on the last axis", unit(cube("2", "0"), nil), "no planes, because NAXIS4 is 0"},
+		{"too many planes", unit(cube("268435456"), samples(8, 0, 1, 2, 3, 4, 5)), "more than 65536 planes"},
+		// the product of these overflows to 0
+		{"overflowing planes", unit(cube("268435456", "268435456", "268435456"), samples(8, 0, 1, 2, 3, 4, 5)), "more than 65536 planes"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error is %v, want one containing %q", err, tc.want)
+			}
+			// reading every page is an error too, not an empty list of pages
+			pages, _, err := DecodePages(bytes.NewReader(tc.data), nil)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("reading every page returned %d pages and error %v, want one containing %q", len(pages), err, tc.want)
+			}
+		})
+	}
+}
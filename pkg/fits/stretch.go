@@ -0,0 +1,123 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package fits
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Stretch chooses the values of a FITS image that become black and white.
+// Values in between are spread evenly over the greys, and values outside are clipped.
+type Stretch struct {
+	// Percentile is true if Low and High are percentiles (0-100) of the image's values,
+	// or false if they are the values themselves
+	Percentile bool
+	Low, High  float64
+}
+
+// MinMax stretches from the smallest value in the image to the largest
+var MinMax = Stretch{Percentile: true, Low: 0, High: 100}
+
+// ParseStretch returns the Stretch described by s, which is one of:
+// minmax, percentile (which is percentile:0.5,99.5), percentile:LOW,HIGH or range:MIN,MAX
+func ParseStretch(s string) (Stretch, error) {
+	name, args, hasArgs := strings.Cut(strings.ToLower(s), ":")
+	var st Stretch
+	switch name {
+	case "minmax":
+		if hasArgs {
+			return st, fmt.Errorf("minmax doesn't take any numbers")
+		}
+		return MinMax, nil
+	case "percentile":
+		st = Stretch{Percentile: true, Low: 0.5, High: 99.5}
+		if !hasArgs {
+			return st, nil
+		}
+	case "range":
+		if !hasArgs {
+			return st, fmt.Errorf("range needs the values for black and white, eg: range:0,1000")
+		}
+	default:
+		return st, fmt.Errorf("unknown stretch %q (must be minmax, percentile, percentile:LOW,HIGH or range:MIN,MAX)", s)
+	}
+
+	lowText, highText, ok := strings.Cut(args, ",")
+	if !ok {
+		return st, fmt.Errorf("%s needs two numbers separated by a comma", name)
+	}
+	var err error
+	if st.Low, err = strconv.ParseFloat(strings.TrimSpace(lowText), 64); err != nil {
+		return st, fmt.Errorf("%s: %q is not a number", name, lowText)
+	}
+	if st.High, err = strconv.ParseFloat(strings.TrimSpace(highText), 64); err != nil {
+		return st, fmt.Errorf("%s: %q is not a number", name, highText)
+	}
+	st.Percentile = name == "percentile"
+	if st.Low >= st.High {
+		return st, fmt.Errorf("%s: the first number must be less than the second", name)
+	}
+	if st.Percentile && (st.Low < 0 || st.High > 100) {
+		return st, fmt.Errorf("percentiles must be between 0 and 100")
+	}
+	return st, nil
+}
+
+// String returns the Stretch in the form that ParseStretch accepts
+func (s Stretch) String() string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	switch {
+	case s == MinMax:
+		return "minmax"
+	case s.Percentile:
+		return "percentile:" + f(s.Low) + "," + f(s.High)
+	}
+	return "range:" + f(s.Low) + "," + f(s.High)
+}
+
+// limits returns the values that become black and white, ignoring NaNs and infinities
+func (s Stretch) limits(values []float64) (float64, float64) {
+	if !s.Percentile {
+		return s.Low, s.High
+	}
+	var sorted []float64
+	for _, v := range values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+	slices.Sort(sorted)
+	return rank(sorted, s.Low), rank(sorted, s.High)
+}
+
+// rank returns the p'th percentile of sorted values, using the nearest-rank method
+func rank(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package fits
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStretch(t *testing.T) {
+	tests := []struct {
+		text string
+		want Stretch
+		name string
+		err  string
+	}{
+		{"minmax", MinMax, "minmax", ""},
+		{"MinMax", MinMax, "minmax", ""},
+		{"percentile", Stretch{true, 0.5, 99.5}, "percentile:0.5,99.5", ""},
+		{"percentile:1, 99", Stretch{true, 1, 99}, "percentile:1,99", ""},
+		{"range:-10,1e4", Stretch{false, -10, 10000}, "range:-10,10000", ""},
+		{"minmax:1,2", Stretch{}, "", "doesn't take"},
+		{"range", Stretch{}, "", "needs the values"},
+		{"range:5", Stretch{}, "", "two numbers"},
+		{"range:5,x", Stretch{}, "", "not a number"},
+		{"range:5,5", Stretch{}, "", "less than"},
+		{"percentile:-1,50", Stretch{}, "", "between 0 and 100"},
+		{"percentile:50,101", Stretch{}, "", "between 0 and 100"},
+		{"zscale", Stretch{}, "", "unknown stretch"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			s, err := ParseStretch(tc.text)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("error is %v, want one containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tc.want {
+				t.Errorf("stretch is %+v, want %+v", s, tc.want)
+			}
+			if s.String() != tc.name {
+				t.Errorf("String() is %q, want %q", s.String(), tc.name)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      Stretch
+		values []float64
+		lo, hi float64
+	}{
+		{"minmax", MinMax, []float64{3, 1, 2}, 1, 3},
+		{"minmax skips NaN and infinity", MinMax, []float64{nan, -inf, 2, 5, inf}, 2, 5},
+		{"no values", MinMax, []float64{nan, inf}, 0, 0},
+		{"percentile", Stretch{true, 10, 90}, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 1, 9},
+		{"range", Stretch{false, -1, 1}, []float64{5, 6}, -1, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lo, hi := tc.s.limits(tc.values)
+			if lo != tc.lo || hi != tc.hi {
+				t.Errorf("limits are %v,%v, want %v,%v", lo, hi, tc.lo, tc.hi)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Alpha is a way of handling the transparency of translucent pixels.
+// Go stores colors premultiplied by their alpha, so a half-transparent white
+// pixel has the same red, green and blue values as an opaque mid-grey.
+type Alpha int
+
+const (
+	// AlphaIgnore uses the premultiplied values as they are, which is the same as
+	// compositing over black
+	AlphaIgnore Alpha = iota
+	// AlphaComposite blends each pixel over a background grey
+	AlphaComposite
+	// AlphaUnpremultiply divides each channel by alpha to recover the color as if it were opaque.
+	// Fully transparent pixels have no color, so they become the background grey.
+	AlphaUnpremultiply
+)
+
+var alphaNames = []string{"ignore", "composite", "unpremultiply"}
+
+// AlphaNames returns the names that ParseAlpha accepts
+func AlphaNames() []string {
+	return append([]string(nil), alphaNames...)
+}
+
+// ParseAlpha returns the Alpha with the given name, eg: composite
+func ParseAlpha(name string) (Alpha, error) {
+	for i, n := range alphaNames {
+		if strings.EqualFold(name, n) {
+			return Alpha(i), nil
+		}
+	}
+	return AlphaIgnore, fmt.Errorf("unknown alpha mode %q (must be one of %s)", name, strings.Join(alphaNames, ", "))
+}
+
+// String returns the name of the Alpha
+func (a Alpha) String() string {
+	if a < 0 || int(a) >= len(alphaNames) {
+		return fmt.Sprintf("Alpha(%d)", int(a))
+	}
+	return alphaNames[a]
+}
+
+// Flatten returns c as an opaque color, using background (0-65535) where the Alpha needs it
+func (a Alpha) Flatten(c color.Color, background uint16) color.Color {
+	r, g, b, alpha := c.RGBA()
+	if alpha == 0xffff || a == AlphaIgnore {
+		return c
+	}
+	bg := uint32(background)
+	switch a {
+	case AlphaComposite:
+		rest := 0xffff - alpha
+		return color.RGBA64{
+			uint16(r + bg*rest/0xffff),
+			uint16(g + bg*rest/0xffff),
+			uint16(b + bg*rest/0xffff),
+			0xffff,
+		}
+	case AlphaUnpremultiply:
+		if alpha == 0 {
+			return color.RGBA64{background, background, background, 0xffff}
+		}
+		return color.RGBA64{
+			uint16(r * 0xffff / alpha),
+			uint16(g * 0xffff / alpha),
+			uint16(b * 0xffff / alpha),
+			0xffff,
+		}
+	}
+	return c
+}
+
+// AlphaCoverage describes how much of an image is transparent
+type AlphaCoverage struct {
+	Pixels      int
+	Opaque      int
+	Translucent int
+	Transparent int
+	// MinAlpha, MaxAlpha and MeanAlpha are in the range 0-65535
+	MinAlpha  uint16
+	MaxAlpha  uint16
+	MeanAlpha float64
+}
+
+// Coverage counts the opaque, translucent and fully transparent pixels of m
+func Coverage(m image.Image) AlphaCoverage {
+	cov := AlphaCoverage{MinAlpha: 0xffff}
+	var sum float64
+	Whole{}.Each(m.Bounds(), func(x, y int) {
+		_, _, _, alpha := m.At(x, y).RGBA()
+		cov.Pixels++
+		switch alpha {
+		case 0xffff:
+			cov.Opaque++
+		case 0:
+			cov.Transparent++
+		default:
+			cov.Translucent++
+		}
+		cov.MinAlpha = min(cov.MinAlpha, uint16(alpha))
+		cov.MaxAlpha = max(cov.MaxAlpha, uint16(alpha))
+		sum += float64(alpha)
+	})
+	if cov.Pixels > 0 {
+		cov.MeanAlpha = sum / float64(cov.Pixels)
+	} else {
+		cov.MinAlpha = 0
+	}
+	return cov
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	// a half-transparent white, premultiplied
+	half := color.RGBA64{0x8000, 0x8000, 0x8000, 0x8000}
+	clear := color.RGBA64{}
+	opaque := color.RGBA64{0x1000, 0x2000, 0x3000, 0xffff}
+	tests := []struct {
+		name       string
+		alpha      Alpha
+		c          color.Color
+		background uint16
+		want       color.RGBA64
+	}{
+		{"ignore", AlphaIgnore, half, 0xffff, half},
+		{"composite over black", AlphaComposite, half, 0, color.RGBA64{0x8000, 0x8000, 0x8000, 0xffff}},
+		{"composite over white", AlphaComposite, half, 0xffff, color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}},
+		{"composite transparent", AlphaComposite, clear, 0x4000, color.RGBA64{0x4000, 0x4000, 0x4000, 0xffff}},
+		{"unpremultiply", AlphaUnpremultiply, half, 0, color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}},
+		{"unpremultiply transparent", AlphaUnpremultiply, clear, 0x4000, color.RGBA64{0x4000, 0x4000, 0x4000, 0xffff}},
+		{"composite opaque", AlphaComposite, opaque, 0xffff, opaque},
+		{"unpremultiply opaque", AlphaUnpremultiply, opaque, 0xffff, opaque},
+	}
+	for _, tc := range tests {
+		got := color.RGBA64Model.Convert(tc.alpha.Flatten(tc.c, tc.background))
+		if got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	m := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	m.SetNRGBA(0, 0, color.NRGBA{10, 20, 30, 255})
+	m.SetNRGBA(1, 0, color.NRGBA{10, 20, 30, 128})
+	m.SetNRGBA(0, 1, color.NRGBA{10, 20, 30, 0})
+	m.SetNRGBA(1, 1, color.NRGBA{10, 20, 30, 255})
+
+	want := AlphaCoverage{
+		Pixels:      4,
+		Opaque:      2,
+		Translucent: 1,
+		Transparent: 1,
+		MinAlpha:    0,
+		MaxAlpha:    0xffff,
+		MeanAlpha:   float64(0xffff*2+128*257) / 4,
+	}
+	if got := Coverage(m); got != want {
+		t.Errorf("coverage is %+v, want %+v", got, want)
+	}
+
+	if got := Coverage(image.NewGray(image.Rect(0, 0, 3, 1))); got != (AlphaCoverage{Pixels: 3, Opaque: 3, MinAlpha: 0xffff, MaxAlpha: 0xffff, MeanAlpha: 0xffff}) {
+		t.Errorf("coverage of an opaque image is %+v", got)
+	}
+	if got := Coverage(image.NewGray(image.Rectangle{})); got != (AlphaCoverage{}) {
+		t.Errorf("coverage of an empty image is %+v", got)
+	}
+}
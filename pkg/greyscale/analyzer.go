@@ -0,0 +1,157 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Analyzer builds histograms from images.
+// The zero value analyzes every pixel of an image.
+type Analyzer struct {
+	// Region limits the analysis to some of the image's pixels.
+	// A nil Region selects the whole image.
+	Region Region
+	// Bins is the number of bins in each Histogram.
+	// Zero means DefaultBins, one for each named grey.
+	Bins int
+	// Luma is the formula that turns each pixel's color into a grey value.
+	// The zero value, LumaRed, assumes the image is already greyscale.
+	Luma Luma
+	// Mask limits the analysis to the pixels where the mask is not black.
+	// It must be the same size as the image. A nil Mask selects every pixel.
+	Mask image.Image
+	// MinAlpha skips the pixels whose alpha is less than MinAlpha, in the range 0-65535.
+	// Zero selects every pixel, and 1 skips only the fully transparent ones.
+	MinAlpha uint32
+	// Alpha is how translucent pixels are turned into opaque colors before they are
+	// measured. The zero value, AlphaIgnore, uses the premultiplied values as they are.
+	Alpha Alpha
+	// Background is the grey (0-65535) that AlphaComposite blends translucent pixels over
+	Background uint16
+}
+
+// Histogram counts the greys in the pixels of m that are selected by the Analyzer
+func (a Analyzer) Histogram(m image.Image) (*Histogram, error) {
+	h, err := a.Levels(m)
+	if err != nil {
+		return nil, err
+	}
+	return h.Rebin(a.bins())
+}
+
+// Levels counts the greys in the pixels of m at full precision,
+// returning a Histogram with one bin for each of the Levels grey values.
+// It can be regrouped into fewer bins with Rebin.
+func (a Analyzer) Levels(m image.Image) (*Histogram, error) {
+	bounds := m.Bounds()
+	h, err := NewHistogram(Levels)
+	if err != nil {
+		return nil, err
+	}
+	h.Total = bounds.Dx() * bounds.Dy()
+
+	err = a.each(m, func(x, y int, c color.Color) {
+		h.Add(a.Luma.Grey(c))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ErrNotSelected is returned when a picked pixel is left out by the Analyzer's Mask or MinAlpha
+var ErrNotSelected = errors.New("not selected by the mask or the minimum alpha")
+
+// Pick returns the grey value of the pixel at x,y in the range 0-65535.
+// The Analyzer's Region is ignored, but the pixel must be selected by its Mask and MinAlpha.
+func (a Analyzer) Pick(m image.Image, x, y int) (uint16, error) {
+	if !image.Pt(x, y).In(m.Bounds()) {
+		return 0, fmt.Errorf("pixel %d,%d is outside the image bounds %v", x, y, m.Bounds())
+	}
+	var grey uint16
+	selected := false
+	a.Region = Rect{x, y, 1, 1}
+	err := a.each(m, func(_, _ int, c color.Color) {
+		grey = a.Luma.Grey(c)
+		selected = true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !selected {
+		return 0, fmt.Errorf("pixel %d,%d: %w", x, y, ErrNotSelected)
+	}
+	return grey, nil
+}
+
+func (a Analyzer) bins() int {
+	if a.Bins == 0 {
+		return DefaultBins
+	}
+	return a.Bins
+}
+
+func (a Analyzer) region() Region {
+	if a.Region == nil {
+		return Whole{}
+	}
+	return a.Region
+}
+
+// each calls fn with the color of every pixel of m that is selected by the
+// Analyzer's Region, Mask and MinAlpha, after it has been flattened by the Analyzer's Alpha
+func (a Analyzer) each(m image.Image, fn func(x, y int, c color.Color)) error {
+	bounds := m.Bounds()
+	var offset image.Point
+	if a.Mask != nil {
+		mb := a.Mask.Bounds()
+		if mb.Dx() != bounds.Dx() || mb.Dy() != bounds.Dy() {
+			return fmt.Errorf("mask is %dx%d but the image is %dx%d", mb.Dx(), mb.Dy(), bounds.Dx(), bounds.Dy())
+		}
+		offset = mb.Min.Sub(bounds.Min)
+	}
+
+	return a.region().Each(bounds, func(x, y int) {
+		if a.Mask != nil {
+			r, g, b, _ := a.Mask.At(x+offset.X, y+offset.Y).RGBA()
+			if r|g|b == 0 {
+				return
+			}
+		}
+		c := m.At(x, y)
+		if a.MinAlpha > 0 {
+			if _, _, _, alpha := c.RGBA(); alpha < a.MinAlpha {
+				return
+			}
+		}
+		fn(x, y, a.flatten(c))
+	})
+}
+
+// flatten applies the Analyzer's Alpha handling to a color
+func (a Analyzer) flatten(c color.Color) color.Color {
+	return a.Alpha.Flatten(c, a.Background)
+}
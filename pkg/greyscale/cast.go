@@ -0,0 +1,159 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// DefaultCastBands is the number of tonal bands that a color cast is measured in
+const DefaultCastBands = 5
+
+// The ways that a color cast can change across the tonal range
+const (
+	// ToningNeutral means there is no noticeable cast
+	ToningNeutral = "neutral"
+	// ToningUniform means the cast has the same hue and strength in every tone
+	ToningUniform = "uniform"
+	// ToningGraded means the cast has the same hue, but its strength changes from tone to tone (eg: sepia)
+	ToningGraded = "graded"
+	// ToningSplit means the shadows and highlights are tinted with different hues
+	ToningSplit = "split"
+)
+
+// splitHue is the smallest difference in hue angle between two tonal bands that counts as split toning
+const splitHue = 45
+
+// ColorCast is the average tint of some pixels, as an offset from neutral grey in CIE Lab
+type ColorCast struct {
+	Pixels int
+	// A is the mean a* value, which is positive for red and negative for green
+	A float64
+	// B is the mean b* value, which is positive for yellow and negative for blue
+	B float64
+}
+
+// Chroma returns the strength of the cast
+func (c ColorCast) Chroma() float64 {
+	return Chroma(c.A, c.B)
+}
+
+// Hue returns the hue angle of the cast in degrees
+func (c ColorCast) Hue() float64 {
+	return Hue(c.A, c.B)
+}
+
+// CastBand is the color cast of the pixels whose L* lightness is in the range MinL to MaxL
+type CastBand struct {
+	MinL, MaxL float64
+	ColorCast
+}
+
+// CastResult is the color cast of an image, overall and in each tonal band from darkest to lightest
+type CastResult struct {
+	ColorCast
+	Bands []CastBand
+}
+
+// Toning describes how the cast changes across the tonal range.
+// Bands with a chroma below threshold are treated as neutral.
+func (r *CastResult) Toning(threshold float64) string {
+	var tinted []CastBand
+	minChroma, maxChroma := math.Inf(1), 0.0
+	for _, b := range r.Bands {
+		if b.Pixels == 0 {
+			continue
+		}
+		minChroma = math.Min(minChroma, b.Chroma())
+		maxChroma = math.Max(maxChroma, b.Chroma())
+		if b.Chroma() >= threshold {
+			tinted = append(tinted, b)
+		}
+	}
+	if len(tinted) == 0 {
+		return ToningNeutral
+	}
+	for i := range tinted {
+		for j := i + 1; j < len(tinted); j++ {
+			if hueDifference(tinted[i].Hue(), tinted[j].Hue()) > splitHue {
+				return ToningSplit
+			}
+		}
+	}
+	if maxChroma-minChroma > math.Max(threshold, maxChroma/2) {
+		return ToningGraded
+	}
+	return ToningUniform
+}
+
+// hueDifference returns the smallest angle between two hues
+func hueDifference(h1, h2 float64) float64 {
+	d := math.Mod(math.Abs(h1-h2), 360)
+	return math.Min(d, 360-d)
+}
+
+// Cast measures the average color cast of the selected pixels, overall and in each of
+// the given number of tonal bands
+func (a Analyzer) Cast(m image.Image, bands int) (*CastResult, error) {
+	if bands < 1 {
+		return nil, fmt.Errorf("number of tonal bands must be at least 1")
+	}
+	res := &CastResult{Bands: make([]CastBand, bands)}
+	for i := range res.Bands {
+		res.Bands[i].MinL = float64(i) * 100 / float64(bands)
+		res.Bands[i].MaxL = float64(i+1) * 100 / float64(bands)
+	}
+
+	err := a.each(m, func(x, y int, c color.Color) {
+		r, g, b, _ := c.RGBA()
+		l, aa, bb := Lab(r, g, b)
+		i := min(max(int(l*float64(bands)/100), 0), bands-1)
+		res.Bands[i].add(aa, bb)
+		res.add(aa, bb)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.finish()
+	for i := range res.Bands {
+		res.Bands[i].finish()
+	}
+	return res, nil
+}
+
+// add sums a pixel's a* and b*, which are turned into means by finish
+func (c *ColorCast) add(a, b float64) {
+	c.Pixels++
+	c.A += a
+	c.B += b
+}
+
+func (c *ColorCast) finish() {
+	if c.Pixels > 0 {
+		c.A /= float64(c.Pixels)
+		c.B /= float64(c.Pixels)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"image/color"
+)
+
+// CheckResult describes how far the pixels of an image are from being neutral grey.
+// Deviations are the difference between the largest and smallest of a pixel's
+// red, green and blue values, in the range 0-65535.
+type CheckResult struct {
+	// Pixels is the number of pixels that were checked
+	Pixels int
+	// MaxDeviation is the largest deviation of any pixel
+	MaxDeviation int
+	// MeanDeviation is the average deviation of all the checked pixels
+	MeanDeviation float64
+	// NonNeutral is the number of pixels whose deviation is more than the tolerance
+	NonNeutral int
+	// Bounds is the smallest rectangle that holds every non-neutral pixel
+	Bounds image.Rectangle
+	// Locations holds the first few non-neutral pixels, in raster order
+	Locations []image.Point
+}
+
+// NonNeutralPercent returns the percentage of the checked pixels that are not neutral
+func (r *CheckResult) NonNeutralPercent() float64 {
+	if r.Pixels == 0 {
+		return 0
+	}
+	return float64(r.NonNeutral) / float64(r.Pixels) * 100
+}
+
+// Greyscale reports whether every checked pixel is neutral
+func (r *CheckResult) Greyscale() bool {
+	return r.NonNeutral == 0
+}
+
+// Deviation returns the difference between the largest and smallest of
+// a color's red, green and blue values, in the range 0-65535
+func Deviation(r, g, b uint32) int {
+	return int(max(r, g, b) - min(r, g, b))
+}
+
+// Check measures how far the red, green and blue values of each selected pixel differ.
+// A pixel is non-neutral if its deviation is more than tolerance.
+// At most `locations` non-neutral pixels are listed in the result.
+func (a Analyzer) Check(m image.Image, tolerance int, locations int) (*CheckResult, error) {
+	res := &CheckResult{}
+	var sum float64
+	err := a.each(m, func(x, y int, c color.Color) {
+		r, g, b, _ := c.RGBA()
+		d := Deviation(r, g, b)
+		res.Pixels++
+		sum += float64(d)
+		res.MaxDeviation = max(res.MaxDeviation, d)
+		if d <= tolerance {
+			return
+		}
+		res.NonNeutral++
+		p := image.Pt(x, y)
+		res.Bounds = res.Bounds.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+		if len(res.Locations) < locations {
+			res.Locations = append(res.Locations, p)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Pixels > 0 {
+		res.MeanDeviation = sum / float64(res.Pixels)
+	}
+	return res, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"math"
+)
+
+// Distance holds measures of how different two histograms are.
+// Each is calculated from the proportion of pixels in each bin,
+// so images of different sizes can be compared.
+type Distance struct {
+	// ChiSquare is the symmetric chi-square distance, from 0 (identical) to 1
+	ChiSquare float64
+	// Bhattacharyya is the Bhattacharyya (Hellinger) distance, from 0 (identical) to 1
+	Bhattacharyya float64
+	// Intersection is the proportion of pixels the histograms have in common,
+	// from 0 (nothing in common) to 1 (identical)
+	Intersection float64
+	// KS is the Kolmogorov–Smirnov statistic: the largest difference between
+	// the two cumulative distributions, from 0 (identical) to 1
+	KS float64
+	// EMD is the Earth Mover's Distance: how far the greys of one histogram have to move,
+	// on average, to match the other. It is on the 16-bit (0-65535) scale.
+	EMD float64
+}
+
+// Compare measures the distance between histogram h and a reference histogram
+// with the same number of bins
+func Compare(h, ref *Histogram) (Distance, error) {
+	var d Distance
+	if h.Bins() != ref.Bins() {
+		return d, fmt.Errorf("can't compare a histogram with %d bins to one with %d bins", h.Bins(), ref.Bins())
+	}
+	if h.Considered == 0 || ref.Considered == 0 {
+		return d, ErrNoPixels
+	}
+
+	n, m := float64(h.Considered), float64(ref.Considered)
+	width := float64(Levels) / float64(h.Bins())
+	var cp, cq, bc float64
+	for i := range h.Counts {
+		p, q := float64(h.Counts[i])/n, float64(ref.Counts[i])/m
+		if p+q > 0 {
+			d.ChiSquare += (p - q) * (p - q) / (p + q)
+		}
+		bc += math.Sqrt(p * q)
+		d.Intersection += math.Min(p, q)
+
+		cp += p
+		cq += q
+		diff := math.Abs(cp - cq)
+		d.KS = math.Max(d.KS, diff)
+		d.EMD += diff * width
+	}
+	d.ChiSquare /= 2
+	// rounding can make the coefficient slightly more than 1 for identical histograms
+	d.Bhattacharyya = math.Sqrt(math.Max(0, 1-bc))
+	return d, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		h, ref []int
+		want   Distance
+	}{
+		{"identical", []int{1, 2, 3, 4}, []int{1, 2, 3, 4}, Distance{Intersection: 1}},
+		// only the proportions matter, not the number of pixels
+		{"same proportions", []int{1, 2, 3, 4}, []int{10, 20, 30, 40}, Distance{Intersection: 1}},
+		{
+			"disjoint",
+			[]int{5, 0, 0, 0},
+			[]int{0, 0, 0, 7},
+			Distance{ChiSquare: 1, Bhattacharyya: 1, Intersection: 0, KS: 1, EMD: 3 * Levels / 4},
+		},
+		{
+			"half",
+			[]int{2, 0},
+			[]int{1, 1},
+			Distance{ChiSquare: 1.0 / 3, Bhattacharyya: math.Sqrt(1 - math.Sqrt(0.5)), Intersection: 0.5, KS: 0.5, EMD: Levels / 4},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Histogram{Counts: tc.h}
+			ref := &Histogram{Counts: tc.ref}
+			for _, c := range tc.h {
+				h.Considered += c
+			}
+			for _, c := range tc.ref {
+				ref.Considered += c
+			}
+			got, err := Compare(h, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metrics := []struct {
+				name      string
+				got, want float64
+			}{
+				{"chi-square", got.ChiSquare, tc.want.ChiSquare},
+				{"Bhattacharyya", got.Bhattacharyya, tc.want.Bhattacharyya},
+				{"intersection", got.Intersection, tc.want.Intersection},
+				{"KS", got.KS, tc.want.KS},
+				{"EMD", got.EMD, tc.want.EMD},
+			}
+			for _, m := range metrics {
+				// the Bhattacharyya distance is a square root, so rounding errors in it are larger
+				if math.Abs(m.got-m.want) > 1e-6 {
+					t.Errorf("%s is %v, want %v", m.name, m.got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	h := &Histogram{Counts: []int{1, 1}, Considered: 2}
+	if _, err := Compare(h, &Histogram{Counts: []int{1, 1, 1}, Considered: 3}); err == nil {
+		t.Error("histograms with different bins didn't return an error")
+	}
+	if _, err := Compare(h, &Histogram{Counts: []int{0, 0}}); !errors.Is(err, ErrNoPixels) {
+		t.Errorf("the error for an empty reference is %v, want ErrNoPixels", err)
+	}
+}
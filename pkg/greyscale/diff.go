@@ -0,0 +1,206 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// DiffMode is a way of drawing the differences between two images
+type DiffMode int
+
+const (
+	// DiffAbsolute draws the size of each difference as a grey, from black (no difference) to white
+	DiffAbsolute DiffMode = iota
+	// DiffSigned draws pixels that are lighter than the reference in red, darker ones in blue,
+	// and unchanged ones in white
+	DiffSigned
+	// DiffThreshold draws the image faded, with the changed pixels highlighted in red
+	DiffThreshold
+)
+
+var diffModeNames = []string{"absolute", "signed", "threshold"}
+
+// DiffModeNames returns the names that ParseDiffMode accepts
+func DiffModeNames() []string {
+	return append([]string(nil), diffModeNames...)
+}
+
+// ParseDiffMode returns the DiffMode with the given name, eg: signed
+func ParseDiffMode(name string) (DiffMode, error) {
+	for i, n := range diffModeNames {
+		if strings.EqualFold(name, n) {
+			return DiffMode(i), nil
+		}
+	}
+	return DiffAbsolute, fmt.Errorf("unknown diff mode %q (must be one of %s)", name, strings.Join(diffModeNames, ", "))
+}
+
+// String returns the name of the DiffMode
+func (d DiffMode) String() string {
+	if d < 0 || int(d) >= len(diffModeNames) {
+		return fmt.Sprintf("DiffMode(%d)", int(d))
+	}
+	return diffModeNames[d]
+}
+
+// DiffRegion is a group of touching changed pixels
+type DiffRegion struct {
+	// Bounds is the smallest rectangle that holds every pixel of the region
+	Bounds image.Rectangle
+	Pixels int
+}
+
+// DiffResult describes the differences between an image and a reference image
+type DiffResult struct {
+	// Image shows where the images differ
+	Image image.Image
+	// Pixels is the number of pixels in each image
+	Pixels int
+	// Changed is the number of pixels whose difference is more than the threshold
+	Changed int
+	// MaxDifference is the largest difference between two pixels, in the range 0-65535
+	MaxDifference int
+	// Regions are the groups of touching changed pixels, in the order they are found from the top left
+	Regions []DiffRegion
+}
+
+// Diff finds where m differs from a reference image of the same size. A pixel has changed if its grey
+// value differs by more than threshold (0-65535). The differences are multiplied by gain when they
+// are drawn, to make small ones visible.
+func (a Analyzer) Diff(m, ref image.Image, mode DiffMode, threshold int, gain float64) (*DiffResult, error) {
+	bounds := m.Bounds()
+	rb := ref.Bounds()
+	if bounds.Dx() != rb.Dx() || bounds.Dy() != rb.Dy() {
+		return nil, fmt.Errorf("image is %dx%d but the reference is %dx%d", bounds.Dx(), bounds.Dy(), rb.Dx(), rb.Dy())
+	}
+	offset := rb.Min.Sub(bounds.Min)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	diffs := make([]int, w*h)
+	greys := make([]uint16, w*h)
+	res := &DiffResult{Pixels: w * h}
+	Whole{}.Each(bounds, func(x, y int) {
+		i := (y-bounds.Min.Y)*w + x - bounds.Min.X
+		greys[i] = a.Luma.Grey(a.flatten(m.At(x, y)))
+		diffs[i] = int(greys[i]) - int(a.Luma.Grey(a.flatten(ref.At(x+offset.X, y+offset.Y))))
+		res.MaxDifference = max(res.MaxDifference, abs(diffs[i]))
+	})
+
+	changed := make([]bool, w*h)
+	for i, d := range diffs {
+		if abs(d) > threshold {
+			changed[i] = true
+			res.Changed++
+		}
+	}
+	res.Regions = regions(changed, w, h, bounds.Min)
+
+	amplify := func(d int) uint16 {
+		return uint16(math.Min(math.Round(float64(d)*gain), 0xffff))
+	}
+	switch mode {
+	case DiffAbsolute:
+		out := image.NewGray16(bounds)
+		for i, d := range diffs {
+			out.SetGray16(bounds.Min.X+i%w, bounds.Min.Y+i/w, color.Gray16{amplify(abs(d))})
+		}
+		res.Image = out
+	case DiffSigned:
+		out := image.NewRGBA64(bounds)
+		for i, d := range diffs {
+			// fade from white towards red for positive differences, and towards blue for negative ones
+			fade := 0xffff - amplify(abs(d))
+			c := color.RGBA64{0xffff, fade, fade, 0xffff}
+			if d < 0 {
+				c = color.RGBA64{fade, fade, 0xffff, 0xffff}
+			}
+			out.SetRGBA64(bounds.Min.X+i%w, bounds.Min.Y+i/w, c)
+		}
+		res.Image = out
+	case DiffThreshold:
+		out := image.NewRGBA64(bounds)
+		for i, g := range greys {
+			// the unchanged pixels are faded halfway to white, so the highlights stand out
+			v := 0x7fff + g/2
+			c := color.RGBA64{v, v, v, 0xffff}
+			if changed[i] {
+				c = color.RGBA64{0xffff, 0, 0, 0xffff}
+			}
+			out.SetRGBA64(bounds.Min.X+i%w, bounds.Min.Y+i/w, c)
+		}
+		res.Image = out
+	default:
+		return nil, fmt.Errorf("unknown diff mode %v", mode)
+	}
+	return res, nil
+}
+
+// regions groups the changed pixels of a w by h image into regions of pixels that touch,
+// including diagonally. The bounds of each region are offset by origin.
+func regions(changed []bool, w, h int, origin image.Point) []DiffRegion {
+	var ret []DiffRegion
+	seen := make([]bool, len(changed))
+	var stack []int
+	for start := range changed {
+		if !changed[start] || seen[start] {
+			continue
+		}
+		r := DiffRegion{Bounds: image.Rect(start%w, start/w, start%w+1, start/w+1)}
+		seen[start] = true
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%w, i/w
+			r.Pixels++
+			r.Bounds = r.Bounds.Union(image.Rect(x, y, x+1, y+1))
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					j := ny*w + nx
+					if changed[j] && !seen[j] {
+						seen[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+		r.Bounds = r.Bounds.Add(origin)
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
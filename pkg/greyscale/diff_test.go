@@ -0,0 +1,122 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	// the reference is mid grey, with offset bounds to check that pixels are matched by position
+	ref := image.NewGray(image.Rect(10, 10, 15, 14))
+	for i := range ref.Pix {
+		ref.Pix[i] = 100
+	}
+	m := flat(5, 4, 100)
+	m.SetGray(0, 0, color.Gray{200}) // a region of two pixels touching at the corner
+	m.SetGray(1, 1, color.Gray{0})
+	m.SetGray(4, 3, color.Gray{150}) // a region of one pixel
+	m.SetGray(4, 0, color.Gray{105}) // a change within the threshold
+
+	res, err := Analyzer{}.Diff(m, ref, DiffAbsolute, 10*257, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Pixels != 20 || res.Changed != 3 || res.MaxDifference != 100*257 {
+		t.Errorf("pixels, changed and largest difference are %d, %d and %d", res.Pixels, res.Changed, res.MaxDifference)
+	}
+	want := []DiffRegion{
+		{image.Rect(0, 0, 2, 2), 2},
+		{image.Rect(4, 3, 5, 4), 1},
+	}
+	if !slices.Equal(res.Regions, want) {
+		t.Errorf("regions are %v, want %v", res.Regions, want)
+	}
+
+	// the absolute differences are tripled, up to white
+	out := res.Image.(*image.Gray16)
+	for _, p := range []struct {
+		x, y int
+		want uint16
+	}{
+		{0, 0, 0xffff},
+		{1, 1, 0xffff},
+		{4, 3, 50 * 257 * 3},
+		{4, 0, 5 * 257 * 3},
+		{2, 2, 0},
+	} {
+		if got := out.Gray16At(p.x, p.y).Y; got != p.want {
+			t.Errorf("the difference at %d,%d is %d, want %d", p.x, p.y, got, p.want)
+		}
+	}
+}
+
+func TestDiffModes(t *testing.T) {
+	ref := flat(3, 1, 100)
+	m := flat(3, 1, 100)
+	m.SetGray(0, 0, color.Gray{200})
+	m.SetGray(2, 0, color.Gray{0})
+	white := color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}
+
+	res, err := Analyzer{}.Diff(m, ref, DiffSigned, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// lighter is red and darker is blue, faded by the size of the difference
+	fade := uint16(0xffff - 100*257)
+	for x, want := range []color.RGBA64{{0xffff, fade, fade, 0xffff}, white, {fade, fade, 0xffff, 0xffff}} {
+		if got := res.Image.(*image.RGBA64).RGBA64At(x, 0); got != want {
+			t.Errorf("signed pixel %d is %v, want %v", x, got, want)
+		}
+	}
+
+	res, err = Analyzer{}.Diff(m, ref, DiffThreshold, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.RGBA64{0xffff, 0, 0, 0xffff}
+	grey := uint16(0x7fff + 100*257/2)
+	for x, want := range []color.RGBA64{red, {grey, grey, grey, 0xffff}, red} {
+		if got := res.Image.(*image.RGBA64).RGBA64At(x, 0); got != want {
+			t.Errorf("threshold pixel %d is %v, want %v", x, got, want)
+		}
+	}
+
+	if _, err := (Analyzer{}).Diff(m, flat(2, 1, 0), DiffAbsolute, 0, 1); err == nil {
+		t.Error("images of different sizes didn't return an error")
+	}
+}
+
+func TestParseDiffMode(t *testing.T) {
+	for _, name := range DiffModeNames() {
+		d, err := ParseDiffMode(name)
+		if err != nil || d.String() != name {
+			t.Errorf("ParseDiffMode(%q) = %v, %v", name, d, err)
+		}
+	}
+	if _, err := ParseDiffMode("xor"); err == nil {
+		t.Error("ParseDiffMode(xor) didn't return an error")
+	}
+}
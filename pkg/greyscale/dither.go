@@ -0,0 +1,307 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+)
+
+// Dither is a method of reducing an image to a few grey levels without banding
+type Dither int
+
+const (
+	// DitherFloydSteinberg spreads each pixel's error over 4 neighbours
+	DitherFloydSteinberg Dither = iota
+	// DitherAtkinson spreads 3/4 of each pixel's error over 6 neighbours, for more contrast
+	DitherAtkinson
+	// DitherJarvisJudiceNinke spreads each pixel's error over 12 neighbours
+	DitherJarvisJudiceNinke
+	// DitherSierra spreads each pixel's error over 10 neighbours
+	DitherSierra
+	// DitherBayer2 uses a 2x2 Bayer threshold matrix
+	DitherBayer2
+	// DitherBayer4 uses a 4x4 Bayer threshold matrix
+	DitherBayer4
+	// DitherBayer8 uses an 8x8 Bayer threshold matrix
+	DitherBayer8
+	// DitherBlueNoise uses a tile of blue noise as the threshold matrix
+	DitherBlueNoise
+)
+
+var ditherNames = []string{"floyd-steinberg", "atkinson", "jarvis-judice-ninke", "sierra", "bayer2", "bayer4", "bayer8", "blue-noise"}
+
+// DitherNames returns the names that ParseDither accepts
+func DitherNames() []string {
+	return append([]string(nil), ditherNames...)
+}
+
+// ParseDither returns the Dither with the given name, eg: atkinson
+func ParseDither(name string) (Dither, error) {
+	for i, n := range ditherNames {
+		if strings.EqualFold(name, n) {
+			return Dither(i), nil
+		}
+	}
+	return DitherFloydSteinberg, fmt.Errorf("unknown dither %q (must be one of %s)", name, strings.Join(ditherNames, ", "))
+}
+
+// String returns the name of the Dither
+func (d Dither) String() string {
+	if d < 0 || int(d) >= len(ditherNames) {
+		return fmt.Sprintf("Dither(%d)", int(d))
+	}
+	return ditherNames[d]
+}
+
+// diffusion is a share of a pixel's error that is passed to the pixel at dx,dy from it
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+// diffusions holds the error diffusion kernels, whose weights add up to 1 or less
+var diffusions = map[Dither][]diffusion{
+	DitherFloydSteinberg: {
+		{1, 0, 7.0 / 16},
+		{-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	},
+	DitherAtkinson: {
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+		{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+		{0, 2, 1.0 / 8},
+	},
+	DitherJarvisJudiceNinke: {
+		{1, 0, 7.0 / 48}, {2, 0, 5.0 / 48},
+		{-2, 1, 3.0 / 48}, {-1, 1, 5.0 / 48}, {0, 1, 7.0 / 48}, {1, 1, 5.0 / 48}, {2, 1, 3.0 / 48},
+		{-2, 2, 1.0 / 48}, {-1, 2, 3.0 / 48}, {0, 2, 5.0 / 48}, {1, 2, 3.0 / 48}, {2, 2, 1.0 / 48},
+	},
+	DitherSierra: {
+		{1, 0, 5.0 / 32}, {2, 0, 3.0 / 32},
+		{-2, 1, 2.0 / 32}, {-1, 1, 4.0 / 32}, {0, 1, 5.0 / 32}, {1, 1, 4.0 / 32}, {2, 1, 2.0 / 32},
+		{-1, 2, 2.0 / 32}, {0, 2, 3.0 / 32}, {1, 2, 2.0 / 32},
+	},
+}
+
+// Dither returns a paletted copy of m reduced to the given number of grey levels (see Palette)
+// with a dithering method. Error diffusion scans alternate rows in opposite directions
+// when serpentine is true, which avoids diagonal artifacts.
+func (a Analyzer) Dither(m image.Image, levels int, method Dither, serpentine bool) (*image.Paletted, error) {
+	palette, err := Palette(levels)
+	if err != nil {
+		return nil, err
+	}
+	p := a.Plane(m)
+	bounds := m.Bounds()
+	out := image.NewPaletted(bounds, palette)
+	step := 255 / float64(levels-1)
+	nearest := func(v float64) int {
+		return min(max(int(math.Round(v/step)), 0), levels-1)
+	}
+	set := func(x, y, i int) {
+		out.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(i))
+	}
+
+	if kernel, ok := diffusions[method]; ok {
+		for y := 0; y < p.Height; y++ {
+			dir := 1
+			if serpentine && y%2 == 1 {
+				dir = -1
+			}
+			for n := 0; n < p.Width; n++ {
+				x := n
+				if dir < 0 {
+					x = p.Width - 1 - n
+				}
+				v := p.at(x, y)
+				i := nearest(v)
+				set(x, y, i)
+				e := v - float64(i)*step
+				for _, d := range kernel {
+					nx, ny := x+d.dx*dir, y+d.dy
+					if nx >= 0 && nx < p.Width && ny < p.Height {
+						p.Pix[ny*p.Width+nx] += e * d.weight
+					}
+				}
+			}
+		}
+		return out, nil
+	}
+
+	var matrix Plane
+	switch method {
+	case DitherBayer2:
+		matrix = bayer(2)
+	case DitherBayer4:
+		matrix = bayer(4)
+	case DitherBayer8:
+		matrix = bayer(8)
+	case DitherBlueNoise:
+		matrix = blueNoise()
+	default:
+		return nil, fmt.Errorf("unknown dither %v", method)
+	}
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			t := matrix.at(x%matrix.Width, y%matrix.Height)
+			set(x, y, nearest(p.at(x, y)+(t-0.5)*step))
+		}
+	}
+	return out, nil
+}
+
+// bayer returns a size by size Bayer matrix, where size is a power of 2,
+// as thresholds between 0 and 1
+func bayer(size int) Plane {
+	ranks := []int{0}
+	for n := 1; n < size; n *= 2 {
+		// each step makes a 2n by 2n matrix from four copies of the n by n one
+		next := make([]int, 4*n*n)
+		for y := 0; y < 2*n; y++ {
+			for x := 0; x < 2*n; x++ {
+				r := 4 * ranks[(y%n)*n+x%n]
+				switch {
+				case x >= n && y >= n:
+					r += 1
+				case x >= n:
+					r += 2
+				case y >= n:
+					r += 3
+				}
+				next[y*2*n+x] = r
+			}
+		}
+		ranks = next
+	}
+	return thresholds(ranks, size)
+}
+
+// thresholds turns the ranks 0 to size*size-1 of a square matrix into thresholds between 0 and 1
+func thresholds(ranks []int, size int) Plane {
+	p := Plane{size, size, make([]float64, len(ranks))}
+	for i, r := range ranks {
+		p.Pix[i] = (float64(r) + 0.5) / float64(len(ranks))
+	}
+	return p
+}
+
+// blueNoiseSize is the width and height of the blue noise tile
+const blueNoiseSize = 64
+
+var blueNoiseTile Plane
+var blueNoiseOnce sync.Once
+
+// blueNoise returns the built-in blue noise tile as thresholds between 0 and 1.
+// It is made the first time it is needed with the void-and-cluster method, from a fixed seed,
+// so it is always the same.
+func blueNoise() Plane {
+	blueNoiseOnce.Do(func() {
+		blueNoiseTile = thresholds(voidAndCluster(blueNoiseSize, 1.5), blueNoiseSize)
+	})
+	return blueNoiseTile
+}
+
+// voidAndCluster ranks the pixels of a size by size tile so that the pixels with the lowest ranks
+// are always spread as evenly as possible (Ulichney, 1993). Closeness is measured with a Gaussian
+// of the given sigma, on a tile that wraps around at the edges.
+func voidAndCluster(size int, sigma float64) []int {
+	n := size * size
+	// weight[dy*size+dx] is the closeness of two pixels that are dx,dy apart
+	weight := make([]float64, n)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			wx, wy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			weight[dy*size+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * sigma * sigma))
+		}
+	}
+
+	// energy[i] is the closeness of pixel i to every pixel that is on
+	on := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(i int) {
+		on[i] = !on[i]
+		sign := 1.0
+		if !on[i] {
+			sign = -1
+		}
+		ix, iy := i%size, i/size
+		for j := range energy {
+			dx := (j%size - ix + size) % size
+			dy := (j/size - iy + size) % size
+			energy[j] += sign * weight[dy*size+dx]
+		}
+	}
+	// find returns the pixel that is on (or off) with the most (or least) energy
+	find := func(state, most bool) int {
+		best := -1
+		for i, e := range energy {
+			if on[i] != state {
+				continue
+			}
+			if best < 0 || (most && e > energy[best]) || (!most && e < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// start with some random pixels, then move them until they are evenly spread
+	rng := rand.New(rand.NewPCG(1, 2))
+	ones := n / 10
+	for _, i := range rng.Perm(n)[:ones] {
+		toggle(i)
+	}
+	for {
+		cluster := find(true, true)
+		toggle(cluster)
+		void := find(false, false)
+		if void == cluster {
+			toggle(cluster)
+			break
+		}
+		toggle(void)
+	}
+	initial := append([]bool(nil), on...)
+	initialEnergy := append([]float64(nil), energy...)
+
+	ranks := make([]int, n)
+	// rank the starting pixels by removing the tightest cluster each time
+	for r := ones - 1; r >= 0; r-- {
+		i := find(true, true)
+		toggle(i)
+		ranks[i] = r
+	}
+	// then fill the largest void each time, until every pixel is on. Past halfway this is
+	// also the tightest cluster of pixels that are off.
+	copy(on, initial)
+	copy(energy, initialEnergy)
+	for r := ones; r < n; r++ {
+		i := find(false, false)
+		toggle(i)
+		ranks[i] = r
+	}
+	return ranks
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDither(t *testing.T) {
+	tests := []struct {
+		name   string
+		method Dither
+		levels int
+		want   []uint8
+	}{
+		// a flat grey halfway between black and white is half on, in each matrix's pattern
+		{"bayer2", DitherBayer2, 2, []uint8{0, 1, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1, 1, 0, 1, 0}},
+		{"bayer4", DitherBayer4, 2, []uint8{0, 1, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1, 1, 0, 1, 0}},
+		{"floyd-steinberg", DitherFloydSteinberg, 2, []uint8{1, 0, 1, 0, 0, 1, 0, 1, 1, 0, 1, 0, 0, 1, 0, 1}},
+	}
+	for _, tc := range tests {
+		out, err := Analyzer{}.Dither(flat(4, 4, 128), tc.levels, tc.method, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(out.Pix, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, out.Pix, tc.want)
+		}
+	}
+}
+
+func TestDitherRamp(t *testing.T) {
+	for _, method := range []Dither{DitherFloydSteinberg, DitherAtkinson, DitherJarvisJudiceNinke, DitherSierra, DitherBayer2, DitherBayer4, DitherBayer8, DitherBlueNoise} {
+		for _, serpentine := range []bool{false, true} {
+			// the greys of the ramp are all in the palette, so there's nothing to dither
+			out, err := Analyzer{}.Dither(ramp(), 16, method, serpentine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}; !slices.Equal(out.Pix, want) {
+				t.Errorf("%v of the ramp is %v, want %v", method, out.Pix, want)
+			}
+
+			// with two levels, about half of the pixels are white, as the ramp's average grey is
+			// halfway. Atkinson drops a quarter of the error, so it doesn't keep the average.
+			if method == DitherAtkinson {
+				continue
+			}
+			out, err = Analyzer{}.Dither(ramp(), 2, method, serpentine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			white := 0
+			for _, i := range out.Pix {
+				white += int(i)
+			}
+			if white < 7 || white > 9 {
+				t.Errorf("%v of the ramp in black and white has %d white pixels, want about 8", method, white)
+			}
+		}
+	}
+}
+
+func TestBayer(t *testing.T) {
+	want := []int{
+		0, 8, 2, 10,
+		12, 4, 14, 6,
+		3, 11, 1, 9,
+		15, 7, 13, 5,
+	}
+	m := bayer(4)
+	for i, v := range m.Pix {
+		if rank := int(v*16 - 0.5); rank != want[i] {
+			t.Fatalf("the ranks of bayer(4) are %v, want %v", m.Pix, want)
+		}
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	// every threshold is used once
+	ranks := voidAndCluster(16, 1.5)
+	sorted := slices.Clone(ranks)
+	slices.Sort(sorted)
+	for i, r := range sorted {
+		if r != i {
+			t.Fatalf("the ranks are not a permutation of 0-255: %v", ranks)
+		}
+	}
+	// the tile is the same every time
+	if !slices.Equal(voidAndCluster(16, 1.5), ranks) {
+		t.Error("the ranks changed between runs")
+	}
+}
+
+func TestParseDither(t *testing.T) {
+	for _, name := range DitherNames() {
+		d, err := ParseDither(name)
+		if err != nil || d.String() != name {
+			t.Errorf("ParseDither(%q) = %v, %v", name, d, err)
+		}
+	}
+	if _, err := ParseDither("random"); err == nil {
+		t.Error("ParseDither(random) didn't return an error")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package greyscale analyzes greyscale images.
+//
+// It is the library behind the greyscale command-line tool. Every function
+// returns its results instead of printing them, so the same analysis can be
+// used from other Go programs.
+//
+// Like the image package, greyscale leaves it to callers to register the image
+// decoders they need, for example:
+//
+//	import _ "image/jpeg"
+//
+// PNG is always registered, since greyscale uses it to write images.
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Scale holds the names of the 16 greys, from darkest to lightest
+var Scale = []string{
+	"Black",
+	"Very Dark Gray",
+	"Dark Gray",
+	"Medium Dark Gray",
+	"Slate Gray",
+	"Dim Gray",
+	"Light Slate Gray",
+	"Gray",
+	"Light Gray",
+	"Gainsboro",
+	"Silver",
+	"Light Silver",
+	"Very Light Gray",
+	"Near White",
+	"Off White",
+	"White",
+}
+
+// ScaleIndex returns the position of the named grey in Scale.
+// The name is matched without regard to case.
+func ScaleIndex(name string) (int, error) {
+	title := cases.Title(language.Und).String(strings.ToLower(name))
+	i := slices.Index(Scale, title)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown color name %q", name)
+	}
+	return i, nil
+}
+
+// Grey returns the amount of "grey" in a color, in the range 0-65535.
+// It's actually the amount of red, since we just assume green and blue are the same.
+// Use a Luma to combine the channels another way.
+func Grey(c color.Color) uint16 {
+	return LumaRed.Grey(c)
+}
+
+// Pick returns the grey value of the pixel at x,y in the range 0-65535.
+// It is the same as calling Pick on the zero Analyzer.
+func Pick(m image.Image, x, y int) (uint16, error) {
+	return Analyzer{}.Pick(m, x, y)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HistogramSchema identifies the layout of a histogram file
+const HistogramSchema = "greyscale-histogram/v1"
+
+// HistogramFile is a set of histograms that is saved as JSON, so that histograms
+// made on different machines can be merged later.
+// Every histogram divides the grey values 0-Levels into Bins equal ranges (see Bin).
+type HistogramFile struct {
+	Schema     string           `json:"schema"`
+	Bins       int              `json:"bins"`
+	Levels     int              `json:"levels"`
+	Luma       string           `json:"luma"`
+	Alpha      string           `json:"alpha"`
+	Host       string           `json:"host,omitempty"`
+	Created    time.Time        `json:"created"`
+	Histograms []SavedHistogram `json:"histograms"`
+}
+
+// SavedHistogram is the histogram of one region of one image
+type SavedHistogram struct {
+	File       string `json:"file"`
+	Region     string `json:"region"`
+	Considered int    `json:"pixels_considered"`
+	Total      int    `json:"pixels_total"`
+	Counts     []int  `json:"counts"`
+}
+
+// NewHistogramFile returns an empty HistogramFile for histograms with the given number of bins,
+// made by an Analyzer with the given Luma and Alpha
+func NewHistogramFile(bins int, luma Luma, alpha Alpha) *HistogramFile {
+	host, _ := os.Hostname()
+	return &HistogramFile{
+		Schema:     HistogramSchema,
+		Bins:       bins,
+		Levels:     Levels,
+		Luma:       luma.String(),
+		Alpha:      alpha.String(),
+		Host:       host,
+		Created:    time.Now().UTC(),
+		Histograms: []SavedHistogram{},
+	}
+}
+
+// Add appends the histogram of a region of an image
+func (hf *HistogramFile) Add(file, region string, h *Histogram) error {
+	if h.Bins() != hf.Bins {
+		return fmt.Errorf("histogram has %d bins, but the file has %d", h.Bins(), hf.Bins)
+	}
+	hf.Histograms = append(hf.Histograms, SavedHistogram{
+		File:       file,
+		Region:     region,
+		Considered: h.Considered,
+		Total:      h.Total,
+		Counts:     append([]int(nil), h.Counts...),
+	})
+	return nil
+}
+
+// Histogram returns the saved histogram as a Histogram
+func (s SavedHistogram) Histogram() *Histogram {
+	return &Histogram{
+		Counts:     append([]int(nil), s.Counts...),
+		Considered: s.Considered,
+		Total:      s.Total,
+	}
+}
+
+// WriteHistogramFile writes hf as compact JSON to a file named f
+func WriteHistogramFile(f string, hf *HistogramFile) error {
+	data, err := json.Marshal(hf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f, append(data, '\n'), 0o644)
+}
+
+// ReadHistogramFile reads a file named f that was written by WriteHistogramFile
+func ReadHistogramFile(f string) (*HistogramFile, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var hf HistogramFile
+	if err := json.Unmarshal(data, &hf); err != nil {
+		return nil, fmt.Errorf("%s: %w", f, err)
+	}
+	if hf.Schema != HistogramSchema {
+		return nil, fmt.Errorf("%s: not a histogram file (schema %q, expected %q)", f, hf.Schema, HistogramSchema)
+	}
+	if hf.Levels != Levels || hf.Bins < MinBins || hf.Bins > Levels {
+		return nil, fmt.Errorf("%s: unsupported bin definition (%d bins of %d levels)", f, hf.Bins, hf.Levels)
+	}
+	for _, s := range hf.Histograms {
+		if len(s.Counts) != hf.Bins {
+			return nil, fmt.Errorf("%s: histogram of %s has %d counts, expected %d", f, s.File, len(s.Counts), hf.Bins)
+		}
+	}
+	return &hf, nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// DefaultBins is the number of bins in a Histogram with one bin for each named grey in Scale
+	DefaultBins = 16
+	// Levels is the number of distinct grey values, and the largest number of bins a Histogram can have
+	Levels = 65536
+	// MinBins is the smallest number of bins a Histogram can have
+	MinBins = 2
+)
+
+// Histogram counts how many of an image's pixels fall into each of its bins.
+// The bins divide the grey values 0-65535 into equal ranges.
+type Histogram struct {
+	// Counts holds the number of pixels in each bin
+	Counts []int
+	// Considered is the number of pixels that were counted
+	Considered int
+	// Total is the number of pixels in the whole image
+	Total int
+}
+
+// NewHistogram returns an empty Histogram with the given number of bins
+func NewHistogram(bins int) (*Histogram, error) {
+	if bins < MinBins || bins > Levels {
+		return nil, fmt.Errorf("number of bins must be between %d and %d", MinBins, Levels)
+	}
+	return &Histogram{Counts: make([]int, bins)}, nil
+}
+
+// Bin returns the bin that a grey value in the range 0-65535 falls into,
+// when the grey values are divided into the given number of bins.
+// With 16 bins, this is the same as shifting the value 12 bits to the right.
+func Bin(grey uint16, bins int) int {
+	return int(grey) * bins / Levels
+}
+
+// Bins returns the number of bins in the histogram
+func (h *Histogram) Bins() int {
+	return len(h.Counts)
+}
+
+// Add counts one pixel with the given grey value
+func (h *Histogram) Add(grey uint16) {
+	h.Counts[Bin(grey, len(h.Counts))]++
+	h.Considered++
+}
+
+// Percent returns the percentage of the considered pixels that fall into bin i
+func (h *Histogram) Percent(i int) float64 {
+	if h.Considered == 0 {
+		return 0
+	}
+	return float64(h.Counts[i]) / float64(h.Considered) * 100
+}
+
+// Range returns the lowest and highest 16-bit grey values that fall into bin i
+func (h *Histogram) Range(i int) (int, int) {
+	n := len(h.Counts)
+	lo := (i*Levels + n - 1) / n
+	hi := ((i+1)*Levels+n-1)/n - 1
+	return lo, hi
+}
+
+// Range8 returns the lowest and highest grey values that fall into bin i, scaled to 8 bits.
+// Neighbouring bins can share an 8-bit value when there are more than 256 bins,
+// or when the number of bins doesn't divide 256 evenly.
+func (h *Histogram) Range8(i int) (int, int) {
+	lo, hi := h.Range(i)
+	return lo >> 8, hi >> 8
+}
+
+// Name returns the name of the grey in the middle of bin i
+func (h *Histogram) Name(i int) string {
+	lo, hi := h.Range(i)
+	return Scale[Bin(uint16((lo+hi)/2), DefaultBins)]
+}
+
+// Rebin returns a copy of the histogram with its counts regrouped into the given number of bins.
+// Each bin is moved to the new bin that holds its lowest grey value,
+// so the result is exact when h has Levels bins.
+func (h *Histogram) Rebin(bins int) (*Histogram, error) {
+	ret, err := NewHistogram(bins)
+	if err != nil {
+		return nil, err
+	}
+	for i, count := range h.Counts {
+		lo, _ := h.Range(i)
+		ret.Counts[Bin(uint16(lo), bins)] += count
+	}
+	ret.Considered = h.Considered
+	ret.Total = h.Total
+	return ret, nil
+}
+
+// Merge adds the counts of o to h, eg: to combine the histograms of several images.
+// Both histograms must have the same number of bins.
+func (h *Histogram) Merge(o *Histogram) error {
+	if o.Bins() != h.Bins() {
+		return fmt.Errorf("can't merge a histogram with %d bins into one with %d bins", o.Bins(), h.Bins())
+	}
+	for i, count := range o.Counts {
+		h.Counts[i] += count
+	}
+	h.Considered += o.Considered
+	h.Total += o.Total
+	return nil
+}
+
+// ColorPercent returns the percentage of the considered pixels that are the named grey.
+// It is only exact when each bin falls entirely within one named grey,
+// as it does when the number of bins is a multiple of 16.
+func (h *Histogram) ColorPercent(name string) (float64, error) {
+	i, err := ScaleIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	named, err := h.Rebin(DefaultBins)
+	if err != nil {
+		return 0, err
+	}
+	return named.Percent(i), nil
+}
+
+// Top returns a copy of the histogram with only the highest `top` counts.
+// The rest of the bins have their count set to 0.
+func (h *Histogram) Top(top int) *Histogram {
+	ret := &Histogram{
+		Counts:     TopValues(h.Counts, top),
+		Considered: h.Considered,
+		Total:      h.Total,
+	}
+	return ret
+}
+
+// TopValues returns a copy of counts with only the highest `top` values.
+// The rest of the items have their value set to 0.
+func TopValues(counts []int, top int) []int {
+	ret := make([]int, len(counts))
+	if top <= 0 || top >= len(counts) {
+		copy(ret, counts)
+		return ret
+	}
+
+	// make a struct to hold each histogram entry
+	type GreyValue struct {
+		GreyNumber int
+		Count      int
+	}
+
+	// make a slice of GreyValue structs from the counts
+	var greys []GreyValue
+	for i, v := range counts {
+		grey := GreyValue{GreyNumber: i, Count: v}
+		greys = append(greys, grey)
+	}
+
+	// reverse sort the slice by Count
+	sort.SliceStable(greys, func(i, j int) bool {
+		return greys[i].Count > greys[j].Count
+	})
+
+	// fill in the output from the slice
+	for _, g := range greys[:top] {
+		ret[g.GreyNumber] = g.Count
+	}
+
+	return ret
+}
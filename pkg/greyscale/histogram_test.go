@@ -0,0 +1,221 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"slices"
+	"testing"
+)
+
+// levels returns a Histogram with one bin for each grey value, holding the given values
+func levels(values ...uint16) *Histogram {
+	h, _ := NewHistogram(Levels)
+	for _, v := range values {
+		h.Add(v)
+	}
+	h.Total = len(values)
+	return h
+}
+
+func TestScaleIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"Black", 0},
+		{"very dark gray", 1},
+		{"LIGHT SLATE GRAY", 6},
+		{"White", 15},
+	}
+	for _, tc := range tests {
+		got, err := ScaleIndex(tc.name)
+		if err != nil || got != tc.want {
+			t.Errorf("ScaleIndex(%q) = %d, %v, want %d", tc.name, got, err, tc.want)
+		}
+	}
+	if _, err := ScaleIndex("purple"); err == nil {
+		t.Error("ScaleIndex(purple) didn't return an error")
+	}
+}
+
+func TestBin(t *testing.T) {
+	tests := []struct {
+		grey uint16
+		bins int
+		want int
+	}{
+		{0, 16, 0},
+		{0x0fff, 16, 0},
+		{0x1000, 16, 1},
+		{0xffff, 16, 15},
+		{0x7fff, 2, 0},
+		{0x8000, 2, 1},
+		{0xffff, 3, 2},
+		{21845, 3, 0},
+		{21846, 3, 1},
+		{1234, Levels, 1234},
+	}
+	for _, tc := range tests {
+		if got := Bin(tc.grey, tc.bins); got != tc.want {
+			t.Errorf("Bin(%d, %d) = %d, want %d", tc.grey, tc.bins, got, tc.want)
+		}
+	}
+}
+
+func TestNewHistogram(t *testing.T) {
+	for _, bins := range []int{0, 1, Levels + 1} {
+		if _, err := NewHistogram(bins); err == nil {
+			t.Errorf("NewHistogram(%d) didn't return an error", bins)
+		}
+	}
+	h, err := NewHistogram(MinBins)
+	if err != nil || h.Bins() != MinBins {
+		t.Errorf("NewHistogram(%d) has %d bins, %v", MinBins, h.Bins(), err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		bins, i  int
+		lo, hi   int
+		lo8, hi8 int
+	}{
+		{16, 0, 0, 4095, 0, 15},
+		{16, 1, 4096, 8191, 16, 31},
+		{16, 15, 61440, 65535, 240, 255},
+		{3, 0, 0, 21845, 0, 85},
+		{3, 1, 21846, 43690, 85, 170},
+		{3, 2, 43691, 65535, 170, 255},
+		{Levels, 300, 300, 300, 1, 1},
+	}
+	for _, tc := range tests {
+		h, _ := NewHistogram(tc.bins)
+		if lo, hi := h.Range(tc.i); lo != tc.lo || hi != tc.hi {
+			t.Errorf("Range(%d) with %d bins = %d-%d, want %d-%d", tc.i, tc.bins, lo, hi, tc.lo, tc.hi)
+		}
+		if lo, hi := h.Range8(tc.i); lo != tc.lo8 || hi != tc.hi8 {
+			t.Errorf("Range8(%d) with %d bins = %d-%d, want %d-%d", tc.i, tc.bins, lo, hi, tc.lo8, tc.hi8)
+		}
+	}
+
+	// the ranges cover every grey value once, and each value is in the bin that Bin says
+	for _, bins := range []int{2, 3, 7, 16, 100, 256, 1000} {
+		h, _ := NewHistogram(bins)
+		next := 0
+		for i := 0; i < bins; i++ {
+			lo, hi := h.Range(i)
+			if lo != next || hi < lo {
+				t.Fatalf("Range(%d) with %d bins = %d-%d, want it to start at %d", i, bins, lo, hi, next)
+			}
+			if Bin(uint16(lo), bins) != i || Bin(uint16(hi), bins) != i {
+				t.Fatalf("Range(%d) with %d bins = %d-%d, which Bin puts in bins %d-%d", i, bins, lo, hi, Bin(uint16(lo), bins), Bin(uint16(hi), bins))
+			}
+			next = hi + 1
+		}
+		if next != Levels {
+			t.Errorf("the ranges of %d bins end at %d, want %d", bins, next-1, Levels-1)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		bins, i int
+		want    string
+	}{
+		{16, 0, "Black"},
+		{16, 15, "White"},
+		{2, 0, "Medium Dark Gray"},
+		{2, 1, "Light Silver"},
+		{Levels, 0x1234, "Very Dark Gray"},
+	}
+	for _, tc := range tests {
+		h, _ := NewHistogram(tc.bins)
+		if got := h.Name(tc.i); got != tc.want {
+			t.Errorf("Name(%d) with %d bins = %q, want %q", tc.i, tc.bins, got, tc.want)
+		}
+	}
+}
+
+func TestRebin(t *testing.T) {
+	full := levels(0, 0x0fff, 0x1000, 0x8000, 0xffff, 0xffff)
+	tests := []struct {
+		name string
+		h    *Histogram
+		bins int
+		want []int
+	}{
+		{"levels to 16", full, 16, []int{2, 1, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 2}},
+		{"levels to 2", full, 2, []int{3, 3}},
+		{"levels to 3", full, 3, []int{3, 1, 2}},
+		{"16 to 4", &Histogram{Counts: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}}, 4, []int{10, 26, 42, 58}},
+		{"2 to 4", &Histogram{Counts: []int{5, 7}}, 4, []int{5, 0, 7, 0}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.h.Considered, tc.h.Total = 6, 10
+			got, err := tc.h.Rebin(tc.bins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got.Counts, tc.want) {
+				t.Errorf("counts are %v, want %v", got.Counts, tc.want)
+			}
+			if got.Considered != 6 || got.Total != 10 {
+				t.Errorf("considered and total are %d and %d, want 6 and 10", got.Considered, got.Total)
+			}
+		})
+	}
+
+	if _, err := full.Rebin(1); err == nil {
+		t.Error("Rebin(1) didn't return an error")
+	}
+}
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		counts []int
+		top    int
+		want   []int
+	}{
+		{[]int{5, 1, 7, 3, 7}, 2, []int{0, 0, 7, 0, 7}},
+		{[]int{5, 1, 7, 3, 7}, 3, []int{5, 0, 7, 0, 7}},
+		{[]int{5, 1, 7, 3, 7}, 0, []int{5, 1, 7, 3, 7}},
+		{[]int{5, 1, 7, 3, 7}, 5, []int{5, 1, 7, 3, 7}},
+		{[]int{5, 1, 7, 3, 7}, 9, []int{5, 1, 7, 3, 7}},
+		// ties keep the lowest bins
+		{[]int{2, 2, 2, 2}, 1, []int{2, 0, 0, 0}},
+	}
+	for _, tc := range tests {
+		h := &Histogram{Counts: slices.Clone(tc.counts), Considered: 23, Total: 30}
+		got := h.Top(tc.top)
+		if !slices.Equal(got.Counts, tc.want) {
+			t.Errorf("Top(%d) of %v = %v, want %v", tc.top, tc.counts, got.Counts, tc.want)
+		}
+		if got.Considered != 23 || got.Total != 30 {
+			t.Errorf("Top(%d) has considered and total %d and %d, want 23 and 30", tc.top, got.Considered, got.Total)
+		}
+		if !slices.Equal(h.Counts, tc.counts) {
+			t.Errorf("Top(%d) changed the histogram to %v", tc.top, h.Counts)
+		}
+	}
+}
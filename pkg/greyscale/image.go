@@ -0,0 +1,206 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An Encoder writes an image to w in some file format
+type Encoder func(w io.Writer, m image.Image) error
+
+// encoders maps lowercase file extensions to the Encoder that WriteImage uses for them
+var encoders = map[string]Encoder{
+	".png": png.Encode,
+}
+
+// RegisterEncoder makes WriteImage use enc for files with the given extension, eg: ".png"
+func RegisterEncoder(ext string, enc Encoder) {
+	encoders[strings.ToLower(ext)] = enc
+}
+
+// A PageDecoder decodes some of the pages of a multi-page image, given their indexes counting
+// from 0, or every page if pages is nil. It also returns the number of pages in the image.
+type PageDecoder func(r io.Reader, pages []int) ([]image.Image, int, error)
+
+// pageDecoders maps the format names that image.Decode returns to their PageDecoder
+var pageDecoders = map[string]PageDecoder{}
+
+// RegisterPageDecoder makes ReadPages use dec for images of the given format, eg: "tiff"
+func RegisterPageDecoder(format string, dec PageDecoder) {
+	pageDecoders[format] = dec
+}
+
+// A HeaderField is one field of the header of an image file, eg: the compression of a BMP image
+type HeaderField struct {
+	Name    string `json:"name" yaml:"name"`
+	Value   string `json:"value" yaml:"value"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// A HeaderReader reads the fields of the header of an image file
+type HeaderReader func(r io.Reader) ([]HeaderField, error)
+
+// headerReaders maps the format names that image.Decode returns to their HeaderReader
+var headerReaders = map[string]HeaderReader{}
+
+// RegisterHeaderReader makes ReadHeader use hr for images of the given format, eg: "bmp"
+func RegisterHeaderReader(format string, hr HeaderReader) {
+	headerReaders[format] = hr
+}
+
+// ReadHeader returns the header fields of a file named f, which holds an image of the given format.
+// It returns nil if there is no HeaderReader for the format (see RegisterHeaderReader).
+func ReadHeader(f, format string) ([]HeaderField, error) {
+	hr, ok := headerReaders[format]
+	if !ok {
+		return nil, nil
+	}
+	reader, err := os.Open(f)
+	if err != nil {
+		return nil, fmt.Errorf("os.open: %w", err)
+	}
+	defer reader.Close()
+	return hr(reader)
+}
+
+// ImageInfo describes the basic properties of a decoded image
+type ImageInfo struct {
+	Format     string
+	ColorModel string
+	Bounds     image.Rectangle
+	Width      int
+	Height     int
+	Pixels     int
+}
+
+// ReadImage reads a file named f and returns
+// a decoded image, file format, and err
+func ReadImage(f string) (image.Image, string, error) {
+	reader, err := os.Open(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("os.open: %w", err)
+	}
+	defer reader.Close()
+
+	return image.Decode(reader)
+}
+
+// ReadPages reads the pages with the given indexes, counting from 0, of a file named f,
+// or every page if pages is nil. It returns the decoded pages, the file format, and the number
+// of pages in the file. Formats without a PageDecoder (see RegisterPageDecoder) have one page.
+func ReadPages(f string, pages []int) ([]image.Image, string, int, error) {
+	reader, err := os.Open(f)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("os.open: %w", err)
+	}
+	defer reader.Close()
+
+	_, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, "", 0, err
+	}
+	if dec, ok := pageDecoders[format]; ok {
+		m, n, err := dec(reader, pages)
+		return m, format, n, err
+	}
+	for _, p := range pages {
+		if p != 0 {
+			return nil, format, 1, fmt.Errorf("there is no page %d, the file has 1 page", p+1)
+		}
+	}
+	m, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, format, 1, err
+	}
+	return []image.Image{m}, format, 1, nil
+}
+
+// WriteImage writes m to a file named f, in the format that matches the file's extension.
+// PNG is always available, and other formats can be added with RegisterEncoder.
+func WriteImage(f string, m image.Image) error {
+	enc, ok := encoders[strings.ToLower(filepath.Ext(f))]
+	if !ok {
+		return fmt.Errorf("don't know how to write a %q file", filepath.Ext(f))
+	}
+
+	writer, err := os.Create(f)
+	if err != nil {
+		return fmt.Errorf("os.create: %w", err)
+	}
+	if err := enc(writer, m); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// Inspect returns the ImageInfo for an image that was decoded from the given format
+func Inspect(m image.Image, format string) ImageInfo {
+	bounds := m.Bounds()
+	return ImageInfo{
+		Format:     format,
+		ColorModel: ColorModelName(m.ColorModel()),
+		Bounds:     bounds,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		Pixels:     bounds.Dx() * bounds.Dy(),
+	}
+}
+
+// ColorModelName returns a short name for one of the standard color models
+func ColorModelName(model color.Model) string {
+	switch model {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.AlphaModel:
+		return "Alpha"
+	case color.Alpha16Model:
+		return "Alpha16"
+	case color.GrayModel:
+		return "Gray"
+	case color.Gray16Model:
+		return "Gray16"
+	case color.CMYKModel:
+		return "CMYK"
+	}
+	if p, ok := model.(color.Palette); ok {
+		return fmt.Sprintf("Paletted (%d colors)", len(p))
+	}
+	return "Unknown"
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"math"
+	"sync"
+)
+
+// D65 white point, used to convert sRGB colors to CIE Lab
+const (
+	whiteX = 0.95047
+	whiteY = 1.00000
+	whiteZ = 1.08883
+)
+
+var linearTable []float64
+var linearOnce sync.Once
+
+// linear converts a 16-bit sRGB channel value to linear light in the range 0-1
+func linear(v uint32) float64 {
+	linearOnce.Do(func() {
+		linearTable = make([]float64, Levels)
+		for i := range linearTable {
+			c := float64(i) / 0xffff
+			if c <= 0.04045 {
+				linearTable[i] = c / 12.92
+			} else {
+				linearTable[i] = math.Pow((c+0.055)/1.055, 2.4)
+			}
+		}
+	})
+	return linearTable[v&0xffff]
+}
+
+// encode converts linear light in the range 0-1 to a 16-bit sRGB channel value
+func encode(v float64) uint16 {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint16(math.Max(0, math.Min(math.Round(v*0xffff), 0xffff)))
+}
+
+// Lab converts 16-bit sRGB values to CIE L*a*b* with a D65 white point.
+// L is in the range 0-100, and a and b are 0 for neutral greys.
+func Lab(r, g, b uint32) (l, a, bb float64) {
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / whiteX
+	y := (0.2126729*lr + 0.7151522*lg + 0.0721750*lb) / whiteY
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func labF(t float64) float64 {
+	const delta = 6.0 / 29
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29
+}
+
+// Chroma returns the distance of a*, b* from neutral grey
+func Chroma(a, b float64) float64 {
+	return math.Hypot(a, b)
+}
+
+// Hue returns the hue angle of a*, b* in degrees, in the range 0-360.
+// Red is near 40, yellow near 90, green near 140, cyan near 200 and blue near 280.
+func Hue(a, b float64) float64 {
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// HueName returns a rough name for a hue angle in degrees
+func HueName(h float64) string {
+	switch {
+	case h < 20:
+		return "magenta"
+	case h < 50:
+		return "red"
+	case h < 75:
+		return "orange"
+	case h < 110:
+		return "yellow"
+	case h < 170:
+		return "green"
+	case h < 230:
+		return "cyan"
+	case h < 315:
+		return "blue"
+	}
+	return "magenta"
+}
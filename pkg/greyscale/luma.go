@@ -0,0 +1,171 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Luma is a formula for turning the red, green and blue values of a color into a single grey value
+type Luma int
+
+const (
+	// LumaRed uses only the red channel, assuming green and blue are the same
+	LumaRed Luma = iota
+	// LumaAverage is the mean of red, green and blue
+	LumaAverage
+	// LumaRec601 weights the channels as in ITU-R BT.601 (standard definition video)
+	LumaRec601
+	// LumaRec709 weights the channels as in ITU-R BT.709 (HD video and sRGB)
+	LumaRec709
+	// LumaRec2020 weights the channels as in ITU-R BT.2020 (UHD video)
+	LumaRec2020
+	// LumaLightness is the HSL lightness, halfway between the largest and smallest channels
+	LumaLightness
+	// LumaMax is the largest of the three channels
+	LumaMax
+	// LumaMin is the smallest of the three channels
+	LumaMin
+
+	// The remaining Lumas are only for converting images (see ParseConversion)
+
+	// LumaGreen uses only the green channel
+	LumaGreen
+	// LumaBlue uses only the blue channel
+	LumaBlue
+	// LumaLuminance is the relative luminance (CIE Y) of the color, encoded with the sRGB curve,
+	// so a color and its grey have the same brightness
+	LumaLuminance
+)
+
+// lumaNames are the names of the Lumas that ParseLuma accepts, in order
+var lumaNames = []string{"red", "average", "rec601", "rec709", "rec2020", "lightness", "max", "min"}
+
+// conversionNames are the other names that ParseConversion accepts. Some of them are names
+// for the Lumas that only convert uses, and the rest are the names used by image editors.
+// The first name for each Luma is its String.
+var conversionNames = []struct {
+	name string
+	luma Luma
+}{
+	{"green", LumaGreen},
+	{"blue", LumaBlue},
+	{"luminance", LumaLuminance},
+	{"channel:r", LumaRed},
+	{"channel:g", LumaGreen},
+	{"channel:b", LumaBlue},
+	{"desaturate", LumaLuminance},
+}
+
+// LumaNames returns the names that ParseLuma accepts
+func LumaNames() []string {
+	return append([]string(nil), lumaNames...)
+}
+
+// ParseLuma returns the Luma with the given name, eg: rec709
+func ParseLuma(name string) (Luma, error) {
+	for i, n := range lumaNames {
+		if strings.EqualFold(name, n) {
+			return Luma(i), nil
+		}
+	}
+	return LumaRed, fmt.Errorf("unknown luma %q (must be one of %s)", name, strings.Join(lumaNames, ", "))
+}
+
+// ConversionNames returns the names that ParseConversion accepts
+func ConversionNames() []string {
+	names := LumaNames()
+	for _, c := range conversionNames {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// ParseConversion returns the Luma for a method of converting colors to greys. It accepts the
+// names that ParseLuma does, as well as green, blue, luminance, channel:r, channel:g, channel:b
+// and desaturate.
+func ParseConversion(name string) (Luma, error) {
+	for _, c := range conversionNames {
+		if strings.EqualFold(name, c.name) {
+			return c.luma, nil
+		}
+	}
+	if l, err := ParseLuma(name); err == nil {
+		return l, nil
+	}
+	return LumaRed, fmt.Errorf("unknown method %q (must be one of %s)", name, strings.Join(ConversionNames(), ", "))
+}
+
+// String returns the name of the Luma
+func (l Luma) String() string {
+	if l >= 0 && int(l) < len(lumaNames) {
+		return lumaNames[l]
+	}
+	for _, c := range conversionNames {
+		if c.luma == l {
+			return c.name
+		}
+	}
+	return fmt.Sprintf("Luma(%d)", int(l))
+}
+
+// Grey returns the grey value of a color in the range 0-65535
+func (l Luma) Grey(c color.Color) uint16 {
+	r, g, b, _ := c.RGBA()
+	return l.grey(r, g, b)
+}
+
+// grey combines 16-bit red, green and blue values
+func (l Luma) grey(r, g, b uint32) uint16 {
+	switch l {
+	case LumaAverage:
+		return uint16((r + g + b) / 3)
+	case LumaRec601:
+		return weigh(r, g, b, 0.299, 0.587, 0.114)
+	case LumaRec709:
+		return weigh(r, g, b, 0.2126, 0.7152, 0.0722)
+	case LumaRec2020:
+		return weigh(r, g, b, 0.2627, 0.6780, 0.0593)
+	case LumaLightness:
+		return uint16((max(r, g, b) + min(r, g, b)) / 2)
+	case LumaMax:
+		return uint16(max(r, g, b))
+	case LumaMin:
+		return uint16(min(r, g, b))
+	case LumaGreen:
+		return uint16(g)
+	case LumaBlue:
+		return uint16(b)
+	case LumaLuminance:
+		return encode(0.2126729*linear(r) + 0.7151522*linear(g) + 0.0721750*linear(b))
+	}
+	return uint16(r)
+}
+
+// weigh returns the weighted sum of red, green and blue, clipped to the range 0-65535
+func weigh(r, g, b uint32, wr, wg, wb float64) uint16 {
+	v := math.Round(wr*float64(r) + wg*float64(g) + wb*float64(b))
+	return uint16(math.Max(0, math.Min(v, 0xffff)))
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestLumaGrey(t *testing.T) {
+	red := color.RGBA64{0xffff, 0, 0, 0xffff}
+	teal := color.RGBA64{0x2000, 0xc000, 0x8000, 0xffff}
+	tests := []struct {
+		luma      Luma
+		red, teal uint16
+	}{
+		{LumaRed, 65535, 8192},
+		{LumaAverage, 21845, 30037},
+		{LumaRec601, 19595, 35037},
+		{LumaRec709, 13933, 39261},
+		{LumaRec2020, 17216, 37420},
+		{LumaLightness, 32767, 28672},
+		{LumaMax, 65535, 49152},
+		{LumaMin, 0, 8192},
+		{LumaGreen, 0, 49152},
+		{LumaBlue, 0, 32768},
+		{LumaLuminance, 32670, 43207},
+	}
+	for _, tc := range tests {
+		if got := tc.luma.Grey(red); got != tc.red {
+			t.Errorf("%v of red = %d, want %d", tc.luma, got, tc.red)
+		}
+		if got := tc.luma.Grey(teal); got != tc.teal {
+			t.Errorf("%v of teal = %d, want %d", tc.luma, got, tc.teal)
+		}
+		// every luma leaves a grey as it is
+		for _, v := range []uint16{0, 1, 0x1234, 0x8000, 0xffff} {
+			if got := tc.luma.Grey(color.Gray16{v}); got != v {
+				t.Errorf("%v of grey %d = %d", tc.luma, v, got)
+			}
+		}
+	}
+}
+
+func TestParseLuma(t *testing.T) {
+	for _, name := range LumaNames() {
+		l, err := ParseLuma(name)
+		if err != nil {
+			t.Errorf("ParseLuma(%q) returned %v", name, err)
+		} else if l.String() != name {
+			t.Errorf("ParseLuma(%q) returned %v", name, l)
+		}
+	}
+	if l, err := ParseLuma("REC709"); err != nil || l != LumaRec709 {
+		t.Errorf("ParseLuma(REC709) = %v, %v, want rec709", l, err)
+	}
+	// the convert-only lumas aren't available to the other commands
+	for _, name := range []string{"sepia", "green", "luminance", "channel:r"} {
+		if _, err := ParseLuma(name); err == nil {
+			t.Errorf("ParseLuma(%s) didn't return an error", name)
+		}
+	}
+}
+
+func TestParseConversion(t *testing.T) {
+	tests := []struct {
+		name string
+		want Luma
+	}{
+		{"rec709", LumaRec709},
+		{"green", LumaGreen},
+		{"blue", LumaBlue},
+		{"Luminance", LumaLuminance},
+		{"channel:r", LumaRed},
+		{"CHANNEL:G", LumaGreen},
+		{"channel:b", LumaBlue},
+		{"desaturate", LumaLuminance},
+	}
+	for _, tc := range tests {
+		if l, err := ParseConversion(tc.name); err != nil || l != tc.want {
+			t.Errorf("ParseConversion(%q) = %v, %v, want %v", tc.name, l, err, tc.want)
+		}
+	}
+	for _, name := range ConversionNames() {
+		if _, err := ParseConversion(name); err != nil {
+			t.Errorf("ParseConversion(%q) returned %v", name, err)
+		}
+	}
+	for _, l := range []Luma{LumaGreen, LumaBlue, LumaLuminance} {
+		if got, err := ParseConversion(l.String()); err != nil || got != l {
+			t.Errorf("ParseConversion(%q) = %v, %v", l.String(), got, err)
+		}
+	}
+	if _, err := ParseConversion("channel:a"); err == nil {
+		t.Error("ParseConversion(channel:a) didn't return an error")
+	}
+}
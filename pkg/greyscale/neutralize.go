@@ -0,0 +1,94 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// BitDepth returns 16 if the color model of m can hold more than 8 bits per channel, or 8 otherwise
+func BitDepth(m image.Image) int {
+	switch m.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Alpha16Model, color.Gray16Model:
+		return 16
+	}
+	return 8
+}
+
+// ChannelGains returns the factors that the red, green and blue channels of the selected pixels
+// are multiplied by to give them all the same average, which removes an overall color cast.
+// This is the "grey world" method of white balancing.
+func (a Analyzer) ChannelGains(m image.Image) ([3]float64, error) {
+	gains := [3]float64{1, 1, 1}
+	var sums [3]float64
+	err := a.each(m, func(x, y int, c color.Color) {
+		r, g, b, _ := c.RGBA()
+		sums[0] += float64(r)
+		sums[1] += float64(g)
+		sums[2] += float64(b)
+	})
+	if err != nil {
+		return gains, err
+	}
+	target := (sums[0] + sums[1] + sums[2]) / 3
+	for i, sum := range sums {
+		if sum > 0 {
+			gains[i] = target / sum
+		}
+	}
+	return gains, nil
+}
+
+// Neutralize returns a single-channel greyscale copy of m, using the Analyzer's Luma
+// to combine the channels after multiplying them by gains (see ChannelGains).
+// The result is an *image.Gray if depth is 8, or an *image.Gray16 if depth is 16.
+func (a Analyzer) Neutralize(m image.Image, gains [3]float64, depth int) (image.Image, error) {
+	bounds := m.Bounds()
+	var set func(x, y int, v uint16)
+	var out image.Image
+	switch depth {
+	case 8:
+		g := image.NewGray(bounds)
+		set = func(x, y int, v uint16) { g.SetGray(x, y, color.Gray{uint8(v >> 8)}) }
+		out = g
+	case 16:
+		g := image.NewGray16(bounds)
+		set = func(x, y int, v uint16) { g.SetGray16(x, y, color.Gray16{v}) }
+		out = g
+	default:
+		return nil, fmt.Errorf("bit depth must be 8 or 16")
+	}
+
+	Whole{}.Each(bounds, func(x, y int) {
+		r, g, b, _ := a.flatten(m.At(x, y)).RGBA()
+		set(x, y, a.Luma.grey(applyGain(r, gains[0]), applyGain(g, gains[1]), applyGain(b, gains[2])))
+	})
+	return out, nil
+}
+
+// applyGain multiplies a 16-bit channel value, clipping the result to the range 0-65535
+func applyGain(v uint32, gain float64) uint32 {
+	return uint32(math.Min(math.Round(float64(v)*gain), 0xffff))
+}
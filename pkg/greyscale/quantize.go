@@ -0,0 +1,61 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// MaxPaletteLevels is the largest number of levels a paletted image can have
+const MaxPaletteLevels = 256
+
+// Palette returns the greys that the given number of levels are drawn with, from black to white.
+// The greys are evenly spaced, and each one is inside the bin of the same index when the
+// grey values are divided into that many bins, so 16 levels give one grey for each name in Scale.
+func Palette(levels int) (color.Palette, error) {
+	if levels < MinBins || levels > MaxPaletteLevels {
+		return nil, fmt.Errorf("number of levels must be between %d and %d", MinBins, MaxPaletteLevels)
+	}
+	p := make(color.Palette, levels)
+	for i := range p {
+		p[i] = color.Gray{uint8((i*255 + (levels-1)/2) / (levels - 1))}
+	}
+	return p, nil
+}
+
+// Quantize returns a paletted copy of m, with each pixel replaced by the palette grey
+// (see Palette) of the bin that its grey value falls into
+func (a Analyzer) Quantize(m image.Image, levels int) (*image.Paletted, error) {
+	palette, err := Palette(levels)
+	if err != nil {
+		return nil, err
+	}
+	bounds := m.Bounds()
+	out := image.NewPaletted(bounds, palette)
+	Whole{}.Each(bounds, func(x, y int) {
+		grey := a.Luma.Grey(a.flatten(m.At(x, y)))
+		out.SetColorIndex(x, y, uint8(Bin(grey, levels)))
+	})
+	return out, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// ramp returns a 4x4 image of the greys 0, 17, 34 ... 255 in raster order,
+// which are the 16 greys of Palette(16)
+func ramp() *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i * 17)
+	}
+	return m
+}
+
+func TestPalette(t *testing.T) {
+	tests := []struct {
+		levels int
+		want   []uint8
+	}{
+		{2, []uint8{0, 255}},
+		{3, []uint8{0, 128, 255}},
+		{4, []uint8{0, 85, 170, 255}},
+		{16, []uint8{0, 17, 34, 51, 68, 85, 102, 119, 136, 153, 170, 187, 204, 221, 238, 255}},
+	}
+	for _, tc := range tests {
+		p, err := Palette(tc.levels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint8
+		for _, c := range p {
+			got = append(got, c.(color.Gray).Y)
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Palette(%d) = %v, want %v", tc.levels, got, tc.want)
+		}
+		// each grey is in the bin of the same index
+		for i, v := range got {
+			if b := Bin(uint16(v)*257, tc.levels); b != i {
+				t.Errorf("grey %d of Palette(%d) is in bin %d", i, tc.levels, b)
+			}
+		}
+	}
+	for _, levels := range []int{1, MaxPaletteLevels + 1} {
+		if _, err := Palette(levels); err == nil {
+			t.Errorf("Palette(%d) didn't return an error", levels)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	tests := []struct {
+		levels int
+		want   []uint8
+	}{
+		{2, []uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1}},
+		{4, []uint8{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3}},
+		{16, []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+	}
+	for _, tc := range tests {
+		out, err := Analyzer{}.Quantize(ramp(), tc.levels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(out.Pix, tc.want) || len(out.Palette) != tc.levels {
+			t.Errorf("Quantize(%d) = %v with %d greys, want %v", tc.levels, out.Pix, len(out.Palette), tc.want)
+		}
+	}
+}
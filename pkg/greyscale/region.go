@@ -0,0 +1,242 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// A Region selects which pixels of an image are analyzed
+type Region interface {
+	// Each calls fn for every selected pixel of an image with the given bounds.
+	// It returns an error if the region doesn't fit the bounds.
+	Each(bounds image.Rectangle, fn func(x, y int)) error
+	// String describes the region in the same form that it is parsed from
+	String() string
+}
+
+// Whole is the Region that selects every pixel of an image
+type Whole struct{}
+
+// String returns "all"
+func (Whole) String() string {
+	return "all"
+}
+
+// Each visits every pixel in bounds
+func (Whole) Each(bounds image.Rectangle, fn func(x, y int)) error {
+	// An image's bounds do not necessarily start at (0, 0), so the two loops start
+	// at bounds.Min.Y and bounds.Min.X. Looping over Y first and X second is more
+	// likely to result in better memory access patterns than X first and Y second.
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			fn(x, y)
+		}
+	}
+	return nil
+}
+
+// Run is a Region of N pixels starting at X,Y and continuing in raster order.
+// A run that would extend beyond the end of the image stops at the last pixel.
+type Run struct {
+	X, Y int
+	N    int
+}
+
+// ParseRun parses a run specified as x,y:n
+func ParseRun(s string) (Run, error) {
+	var r Run
+
+	// turn xy:n into [xy n] strings
+	xyxyn := strings.Split(s, ":")
+	if len(xyxyn) != 2 {
+		return r, fmt.Errorf("pixels must be specified as x,y:n")
+	}
+	// turn xy into [x y] ints
+	xyxy := strings.Split(xyxyn[0], ",")
+	if len(xyxy) != 2 {
+		return r, fmt.Errorf("pixels must be specified as x,y:n")
+	}
+
+	var err error
+	r.X, err = strconv.Atoi(xyxy[0])
+	if err != nil {
+		return r, fmt.Errorf("x couldn't be converted to a number")
+	}
+	r.Y, err = strconv.Atoi(xyxy[1])
+	if err != nil {
+		return r, fmt.Errorf("y couldn't be converted to a number")
+	}
+	r.N, err = strconv.Atoi(xyxyn[1])
+	if err != nil {
+		return r, fmt.Errorf("number of pixels couldn't be converted to a number")
+	}
+	if r.N < 1 {
+		return r, fmt.Errorf("number of pixels must be at least 1")
+	}
+	return r, nil
+}
+
+// String returns the run as x,y:n
+func (r Run) String() string {
+	return fmt.Sprintf("%d,%d:%d", r.X, r.Y, r.N)
+}
+
+// Each visits the pixels of the run
+func (r Run) Each(bounds image.Rectangle, fn func(x, y int)) error {
+	if r.X < bounds.Min.X || r.X >= bounds.Max.X {
+		return fmt.Errorf("x value %d is outside the image width", r.X)
+	}
+	if r.Y < bounds.Min.Y || r.Y >= bounds.Max.Y {
+		return fmt.Errorf("y value %d is outside the image height", r.Y)
+	}
+
+	n := 0
+	x := r.X
+	for y := r.Y; y < bounds.Max.Y; y++ {
+		for ; x < bounds.Max.X; x++ {
+			fn(x, y)
+			n++
+			if n == r.N {
+				return nil
+			}
+		}
+		// every row after the first starts at the left edge
+		x = bounds.Min.X
+	}
+	return nil
+}
+
+// Rect is a Region of W by H pixels with its top left corner at X,Y.
+// The part of the rectangle that is outside the image is ignored.
+type Rect struct {
+	X, Y int
+	W, H int
+}
+
+// ParseRect parses a rectangle specified as x,y,w,h
+func ParseRect(s string) (Rect, error) {
+	var r Rect
+	n, err := parseInts(s)
+	if err != nil {
+		return r, err
+	}
+	if len(n) != 4 {
+		return r, fmt.Errorf("rectangle must be specified as x,y,w,h")
+	}
+	r = Rect{n[0], n[1], n[2], n[3]}
+	if r.W < 1 || r.H < 1 {
+		return r, fmt.Errorf("rectangle width and height must be at least 1")
+	}
+	return r, nil
+}
+
+// String returns the rectangle as x,y,w,h
+func (r Rect) String() string {
+	return fmt.Sprintf("%d,%d,%d,%d", r.X, r.Y, r.W, r.H)
+}
+
+// Each visits the pixels of the rectangle that are inside bounds
+func (r Rect) Each(bounds image.Rectangle, fn func(x, y int)) error {
+	clipped := image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H).Intersect(bounds)
+	if clipped.Empty() {
+		return fmt.Errorf("rectangle %s is outside the image bounds %v", r, bounds)
+	}
+	return Whole{}.Each(clipped, fn)
+}
+
+// Polygon is a Region of the pixels whose centers are inside a closed polygon.
+// Pixels are inside if a line from them crosses the polygon's edges an odd number of times.
+type Polygon []image.Point
+
+// ParsePolygon parses a polygon specified as x1,y1,x2,y2,x3,y3,...
+func ParsePolygon(s string) (Polygon, error) {
+	n, err := parseInts(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(n)%2 != 0 || len(n) < 6 {
+		return nil, fmt.Errorf("polygon must be specified as at least three x,y points")
+	}
+	var p Polygon
+	for i := 0; i < len(n); i += 2 {
+		p = append(p, image.Pt(n[i], n[i+1]))
+	}
+	return p, nil
+}
+
+// String returns the polygon as x1,y1,x2,y2,...
+func (p Polygon) String() string {
+	var xy []string
+	for _, pt := range p {
+		xy = append(xy, strconv.Itoa(pt.X), strconv.Itoa(pt.Y))
+	}
+	return strings.Join(xy, ",")
+}
+
+// Each visits the pixels inside the polygon that are also inside bounds
+func (p Polygon) Each(bounds image.Rectangle, fn func(x, y int)) error {
+	var box image.Rectangle
+	for _, pt := range p {
+		box = box.Union(image.Rectangle{pt, pt.Add(image.Pt(1, 1))})
+	}
+	clipped := box.Intersect(bounds)
+	if clipped.Empty() {
+		return fmt.Errorf("polygon %s is outside the image bounds %v", p, bounds)
+	}
+	return Whole{}.Each(clipped, func(x, y int) {
+		if p.contains(float64(x)+0.5, float64(y)+0.5) {
+			fn(x, y)
+		}
+	})
+}
+
+// contains reports whether the point x,y is inside the polygon, using the even-odd rule
+func (p Polygon) contains(x, y float64) bool {
+	inside := false
+	j := len(p) - 1
+	for i := range p {
+		xi, yi := float64(p[i].X), float64(p[i].Y)
+		xj, yj := float64(p[j].X), float64(p[j].Y)
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
+
+// parseInts parses a comma-separated list of integers
+func parseInts(s string) ([]int, error) {
+	var ret []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("%q couldn't be converted to a number", field)
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+// pixels returns the pixels a Region visits, in order
+func pixels(r Region, bounds image.Rectangle) ([]image.Point, error) {
+	var pts []image.Point
+	err := r.Each(bounds, func(x, y int) {
+		pts = append(pts, image.Pt(x, y))
+	})
+	return pts, err
+}
+
+// grid returns the pixels of a w by h image, starting at x,y, that are marked with 1 in rows
+func grid(x, y int, rows ...string) []image.Point {
+	var pts []image.Point
+	for j, row := range rows {
+		for i, c := range row {
+			if c == '1' {
+				pts = append(pts, image.Pt(x+i, y+j))
+			}
+		}
+	}
+	return pts
+}
+
+func TestRegionEach(t *testing.T) {
+	four := image.Rect(0, 0, 4, 4)
+	tests := []struct {
+		name   string
+		region Region
+		bounds image.Rectangle
+		want   []image.Point
+	}{
+		{"whole", Whole{}, image.Rect(0, 0, 2, 2), grid(0, 0, "11", "11")},
+		{"run", Run{2, 1, 4}, four, grid(0, 0, "0000", "0011", "1100", "0000")},
+		{"run past the end", Run{3, 3, 10}, four, grid(0, 0, "0000", "0000", "0000", "0001")},
+		{"rect", Rect{1, 1, 2, 2}, four, grid(0, 0, "0000", "0110", "0110", "0000")},
+		{"rect over the edge", Rect{3, 2, 5, 5}, four, grid(0, 0, "0000", "0000", "0001", "0001")},
+		{"rect in offset bounds", Rect{9, 9, 2, 2}, image.Rect(10, 10, 14, 14), grid(10, 10, "1")},
+		// a pixel is inside if its center is, so the edges of a square on pixel
+		// boundaries select exactly the pixels it covers
+		{"square", Polygon{{1, 1}, {3, 1}, {3, 3}, {1, 3}}, four, grid(0, 0, "0000", "0110", "0110", "0000")},
+		{"triangle", Polygon{{0, 0}, {4, 0}, {0, 3}}, four, grid(0, 0, "1110", "1100", "1000", "0000")},
+		{
+			// the inner square goes the same way round as the outer one, so only the
+			// even-odd rule leaves it out
+			"square with a hole",
+			Polygon{{0, 0}, {6, 0}, {6, 6}, {0, 6}, {0, 0}, {2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}},
+			image.Rect(0, 0, 6, 6),
+			grid(0, 0, "111111", "111111", "110011", "110011", "111111", "111111"),
+		},
+		{
+			"bow tie",
+			Polygon{{0, 0}, {6, 4}, {6, 0}, {0, 4}},
+			image.Rect(0, 0, 6, 4),
+			grid(0, 0, "100001", "110011", "110011", "100001"),
+		},
+		{"polygon over the edge", Polygon{{-2, -2}, {2, -2}, {2, 2}, {-2, 2}}, four, grid(0, 0, "11", "11")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := pixels(tc.region, tc.bounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("pixels are %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRegionOutside(t *testing.T) {
+	bounds := image.Rect(0, 0, 4, 4)
+	for _, r := range []Region{
+		Run{4, 0, 1},
+		Run{0, -1, 1},
+		Rect{4, 0, 2, 2},
+		Rect{-3, -3, 3, 3},
+		Polygon{{5, 5}, {8, 5}, {5, 8}},
+	} {
+		if _, err := pixels(r, bounds); err == nil {
+			t.Errorf("%T %v didn't return an error", r, r)
+		}
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Region
+		err  bool
+	}{
+		{"1,2,3,4", Rect{1, 2, 3, 4}, false},
+		{" 1, 2, 3, 4", Rect{1, 2, 3, 4}, false},
+		{"1,2,3", nil, true},
+		{"1,2,0,4", nil, true},
+		{"1,2,x,4", nil, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseRect(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseRect(%q) didn't return an error", tc.s)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ParseRect(%q) = %v, %v, want %v", tc.s, got, err, tc.want)
+		}
+		if got.String() != "1,2,3,4" {
+			t.Errorf("the rectangle is written as %q", got.String())
+		}
+	}
+
+	p, err := ParsePolygon("0,0,4,0,0,4")
+	if err != nil || !slices.Equal(p, Polygon{{0, 0}, {4, 0}, {0, 4}}) {
+		t.Errorf("ParsePolygon = %v, %v", p, err)
+	}
+	if p.String() != "0,0,4,0,0,4" {
+		t.Errorf("the polygon is written as %q", p.String())
+	}
+	for _, s := range []string{"0,0,4,0", "0,0,4,0,0", "0,0,4,0,0,y"} {
+		if _, err := ParsePolygon(s); err == nil {
+			t.Errorf("ParsePolygon(%q) didn't return an error", s)
+		}
+	}
+
+	r, err := ParseRun("3,4:5")
+	if err != nil || r != (Run{3, 4, 5}) || r.String() != "3,4:5" {
+		t.Errorf("ParseRun = %v, %v", r, err)
+	}
+	for _, s := range []string{"3,4", "3:5", "3,4:0", "a,4:5"} {
+		if _, err := ParseRun(s); err == nil {
+			t.Errorf("ParseRun(%q) didn't return an error", s)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// ssimWindow is the size of the Gaussian window that SSIM is measured in, and ssimSigma is its spread
+const (
+	ssimWindow = 11
+	ssimSigma  = 1.5
+)
+
+// msssimWeights are the weights of each scale of MS-SSIM, from finest to coarsest
+var msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+// Plane holds the grey values of an image on the 8-bit (0-255) scale, in raster order
+type Plane struct {
+	Width, Height int
+	Pix           []float64
+}
+
+// Plane returns the grey values of every pixel of m, using the Analyzer's Luma and Alpha
+func (a Analyzer) Plane(m image.Image) Plane {
+	bounds := m.Bounds()
+	p := Plane{bounds.Dx(), bounds.Dy(), make([]float64, 0, bounds.Dx()*bounds.Dy())}
+	Whole{}.Each(bounds, func(x, y int) {
+		// an 8-bit value v is stored as v*257 in 16 bits
+		p.Pix = append(p.Pix, float64(a.Luma.Grey(a.flatten(m.At(x, y))))/257)
+	})
+	return p
+}
+
+// at returns the grey value at x,y, counted from the top left of the plane
+func (p Plane) at(x, y int) float64 {
+	return p.Pix[y*p.Width+x]
+}
+
+// Similarity holds full-reference quality measures between an image and a reference image
+type Similarity struct {
+	// MAE is the mean absolute error on the 8-bit scale
+	MAE float64
+	// MSE is the mean squared error on the 8-bit scale
+	MSE float64
+	// PSNR is the peak signal-to-noise ratio in decibels, which is +Inf for identical images
+	PSNR float64
+	// SSIM is the mean structural similarity, from -1 to 1 (identical)
+	SSIM float64
+}
+
+// TileSimilarity is the Similarity of one rectangular tile of the images
+type TileSimilarity struct {
+	Bounds image.Rectangle
+	Similarity
+}
+
+// SimilarityResult is the Similarity of two whole images, along with their multi-scale
+// SSIM and the Similarity of each tile
+type SimilarityResult struct {
+	Similarity
+	// MSSSIM is the multi-scale structural similarity, from 0 to 1 (identical)
+	MSSSIM float64
+	// Scales is the number of scales MS-SSIM was measured at. Images that are too small
+	// for all 5 scales use fewer, with their weights rescaled.
+	Scales int
+	Tiles  []TileSimilarity
+}
+
+// CompareImages measures how similar m is to a reference image of the same size.
+// If tile is more than 0, the images are also divided into tiles of that size, and
+// each one is measured separately.
+func (a Analyzer) CompareImages(m, ref image.Image, tile int) (*SimilarityResult, error) {
+	if m.Bounds().Dx() != ref.Bounds().Dx() || m.Bounds().Dy() != ref.Bounds().Dy() {
+		return nil, fmt.Errorf("image is %dx%d but the reference is %dx%d",
+			m.Bounds().Dx(), m.Bounds().Dy(), ref.Bounds().Dx(), ref.Bounds().Dy())
+	}
+	p, q := a.Plane(m), a.Plane(ref)
+	if len(p.Pix) == 0 {
+		return nil, ErrNoPixels
+	}
+
+	res := &SimilarityResult{}
+	ssim, _ := ssimMap(p, q)
+	res.Similarity = pixelErrors(p, q, image.Rect(0, 0, p.Width, p.Height))
+	res.SSIM = ssim.mean(image.Rect(0, 0, p.Width, p.Height))
+	res.MSSSIM, res.Scales = msssim(p, q)
+
+	if tile > 0 {
+		for y := 0; y < p.Height; y += tile {
+			for x := 0; x < p.Width; x += tile {
+				r := image.Rect(x, y, min(x+tile, p.Width), min(y+tile, p.Height))
+				t := TileSimilarity{r, pixelErrors(p, q, r)}
+				t.SSIM = ssim.mean(r)
+				res.Tiles = append(res.Tiles, t)
+			}
+		}
+	}
+	return res, nil
+}
+
+// pixelErrors returns the MAE, MSE and PSNR of the pixels of p and q inside r
+func pixelErrors(p, q Plane, r image.Rectangle) Similarity {
+	var s Similarity
+	n := float64(r.Dx() * r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := p.at(x, y) - q.at(x, y)
+			s.MAE += math.Abs(d)
+			s.MSE += d * d
+		}
+	}
+	s.MAE /= n
+	s.MSE /= n
+	s.PSNR = math.Inf(1)
+	if s.MSE > 0 {
+		s.PSNR = 10 * math.Log10(255*255/s.MSE)
+	}
+	return s
+}
+
+// similarityMap holds a value for each position of the SSIM window.
+// The window at position x,y is centered on the pixel offset+x, offset+y.
+type similarityMap struct {
+	Plane
+	offset int
+}
+
+// mean returns the mean of the values whose window is centered inside r.
+// If no window is centered inside r, it uses the nearest window.
+func (s similarityMap) mean(r image.Rectangle) float64 {
+	var sum float64
+	n := 0
+	for y := max(r.Min.Y-s.offset, 0); y < min(r.Max.Y-s.offset, s.Height); y++ {
+		for x := max(r.Min.X-s.offset, 0); x < min(r.Max.X-s.offset, s.Width); x++ {
+			sum += s.at(x, y)
+			n++
+		}
+	}
+	if n == 0 {
+		cx := min(max((r.Min.X+r.Max.X)/2-s.offset, 0), s.Width-1)
+		cy := min(max((r.Min.Y+r.Max.Y)/2-s.offset, 0), s.Height-1)
+		return s.at(cx, cy)
+	}
+	return sum / float64(n)
+}
+
+// ssimMap returns the SSIM and the contrast-structure part of SSIM for every position of
+// a Gaussian window that fits inside the planes. Planes smaller than the window use a smaller one.
+func ssimMap(p, q Plane) (ssim, cs similarityMap) {
+	size := min(ssimWindow, p.Width, p.Height)
+	if size%2 == 0 {
+		size--
+	}
+	kernel := gaussian(size, ssimSigma)
+
+	sq := func(f func(i int) float64) Plane {
+		out := Plane{p.Width, p.Height, make([]float64, len(p.Pix))}
+		for i := range out.Pix {
+			out.Pix[i] = f(i)
+		}
+		return out
+	}
+	mu1 := blur(p, kernel)
+	mu2 := blur(q, kernel)
+	e11 := blur(sq(func(i int) float64 { return p.Pix[i] * p.Pix[i] }), kernel)
+	e22 := blur(sq(func(i int) float64 { return q.Pix[i] * q.Pix[i] }), kernel)
+	e12 := blur(sq(func(i int) float64 { return p.Pix[i] * q.Pix[i] }), kernel)
+
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	const c2 = (0.03 * 255) * (0.03 * 255)
+	ssim = similarityMap{Plane{mu1.Width, mu1.Height, make([]float64, len(mu1.Pix))}, size / 2}
+	cs = similarityMap{Plane{mu1.Width, mu1.Height, make([]float64, len(mu1.Pix))}, size / 2}
+	for i := range mu1.Pix {
+		m1, m2 := mu1.Pix[i], mu2.Pix[i]
+		s11 := e11.Pix[i] - m1*m1
+		s22 := e22.Pix[i] - m2*m2
+		s12 := e12.Pix[i] - m1*m2
+		cs.Pix[i] = (2*s12 + c2) / (s11 + s22 + c2)
+		ssim.Pix[i] = (2*m1*m2 + c1) / (m1*m1 + m2*m2 + c1) * cs.Pix[i]
+	}
+	return ssim, cs
+}
+
+// msssim returns the multi-scale SSIM of p and q, and the number of scales it used
+func msssim(p, q Plane) (float64, int) {
+	scales := 1
+	for w, h := p.Width/2, p.Height/2; scales < len(msssimWeights) && min(w, h) >= ssimWindow; w, h = w/2, h/2 {
+		scales++
+	}
+	var total float64
+	for _, w := range msssimWeights[:scales] {
+		total += w
+	}
+
+	result := 1.0
+	for i := range scales {
+		ssim, cs := ssimMap(p, q)
+		bounds := image.Rect(0, 0, p.Width, p.Height)
+		value := cs.mean(bounds)
+		if i == scales-1 {
+			value = ssim.mean(bounds)
+		}
+		// negative values have no real fractional power, so they count as no similarity
+		result *= math.Pow(math.Max(value, 0), msssimWeights[i]/total)
+		p, q = halve(p), halve(q)
+	}
+	return result, scales
+}
+
+// gaussian returns a normalized Gaussian kernel with the given odd size
+func gaussian(size int, sigma float64) []float64 {
+	k := make([]float64, size)
+	var sum float64
+	for i := range k {
+		d := float64(i - size/2)
+		k[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += k[i]
+	}
+	for i := range k {
+		k[i] /= sum
+	}
+	return k
+}
+
+// blur filters p with a separable kernel, keeping only the positions where the kernel fits
+func blur(p Plane, kernel []float64) Plane {
+	n := len(kernel)
+	w, h := p.Width-n+1, p.Height-n+1
+	rows := Plane{w, p.Height, make([]float64, w*p.Height)}
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < w; x++ {
+			var sum float64
+			for i, k := range kernel {
+				sum += k * p.at(x+i, y)
+			}
+			rows.Pix[y*w+x] = sum
+		}
+	}
+	out := Plane{w, h, make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum float64
+			for i, k := range kernel {
+				sum += k * rows.at(x, y+i)
+			}
+			out.Pix[y*w+x] = sum
+		}
+	}
+	return out
+}
+
+// halve returns p at half the width and height, averaging each 2x2 block of pixels
+func halve(p Plane) Plane {
+	w, h := p.Width/2, p.Height/2
+	out := Plane{w, h, make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Pix[y*w+x] = (p.at(2*x, 2*y) + p.at(2*x+1, 2*y) + p.at(2*x, 2*y+1) + p.at(2*x+1, 2*y+1)) / 4
+		}
+	}
+	return out
+}
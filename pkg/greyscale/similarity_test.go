@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// pattern returns a w by h grey image with a gradient and a checkerboard, so it has some structure
+func pattern(w, h int) *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := x * 200 / w
+			if (x/4+y/4)%2 == 0 {
+				v += 50
+			}
+			m.SetGray(x, y, color.Gray{uint8(v)})
+		}
+	}
+	return m
+}
+
+// flat returns a w by h image that is all one grey
+func flat(w, h int, v uint8) *image.Gray {
+	m := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range m.Pix {
+		m.Pix[i] = v
+	}
+	return m
+}
+
+func TestCompareImages(t *testing.T) {
+	m := pattern(32, 32)
+	res, err := Analyzer{}.CompareImages(m, m, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MAE != 0 || res.MSE != 0 || !math.IsInf(res.PSNR, 1) {
+		t.Errorf("MAE, MSE and PSNR of an image with itself are %v, %v and %v", res.MAE, res.MSE, res.PSNR)
+	}
+	if !near(res.SSIM, 1) || !near(res.MSSSIM, 1) {
+		t.Errorf("SSIM and MS-SSIM of an image with itself are %v and %v, want 1", res.SSIM, res.MSSSIM)
+	}
+	// 32 pixels is big enough for a second scale, but not a third
+	if res.Scales != 2 {
+		t.Errorf("MS-SSIM used %d scales, want 2", res.Scales)
+	}
+	want := []image.Rectangle{image.Rect(0, 0, 16, 16), image.Rect(16, 0, 32, 16), image.Rect(0, 16, 16, 32), image.Rect(16, 16, 32, 32)}
+	if len(res.Tiles) != len(want) {
+		t.Fatalf("there are %d tiles, want %d", len(res.Tiles), len(want))
+	}
+	for i, tile := range res.Tiles {
+		if tile.Bounds != want[i] || !near(tile.SSIM, 1) || tile.MSE != 0 {
+			t.Errorf("tile %d is %v with SSIM %v and MSE %v", i, tile.Bounds, tile.SSIM, tile.MSE)
+		}
+	}
+}
+
+func TestCompareImagesOffset(t *testing.T) {
+	// every pixel is 10 lighter, so the errors are exact, and SSIM only
+	// loses its luminance term because neither image has any contrast
+	res, err := Analyzer{}.CompareImages(flat(12, 12, 110), flat(12, 12, 100), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const c1 = (0.01 * 255) * (0.01 * 255)
+	ssim := (2*100*110 + c1) / (100*100 + 110*110 + c1)
+	if !near(res.MAE, 10) || !near(res.MSE, 100) || !near(res.PSNR, 10*math.Log10(255*255/100.0)) {
+		t.Errorf("MAE, MSE and PSNR are %v, %v and %v", res.MAE, res.MSE, res.PSNR)
+	}
+	if !near(res.SSIM, ssim) {
+		t.Errorf("SSIM is %v, want %v", res.SSIM, ssim)
+	}
+	// tiles at the edges are smaller
+	if len(res.Tiles) != 9 || res.Tiles[8].Bounds != image.Rect(10, 10, 12, 12) {
+		t.Fatalf("the tiles are %v", res.Tiles)
+	}
+	for _, tile := range res.Tiles {
+		if !near(tile.MAE, 10) || !near(tile.SSIM, ssim) {
+			t.Errorf("tile %v has MAE %v and SSIM %v", tile.Bounds, tile.MAE, tile.SSIM)
+		}
+	}
+}
+
+func TestCompareImagesDifferent(t *testing.T) {
+	m := pattern(32, 32)
+	inverted := image.NewGray(m.Bounds())
+	for i, v := range m.Pix {
+		inverted.Pix[i] = 255 - v
+	}
+	res, err := Analyzer{}.CompareImages(m, inverted, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SSIM >= 0 || res.MSSSIM != 0 {
+		t.Errorf("SSIM and MS-SSIM of an inverted image are %v and %v, want less than 0 and 0", res.SSIM, res.MSSSIM)
+	}
+	if res.Tiles != nil {
+		t.Errorf("there are %d tiles without a tile size", len(res.Tiles))
+	}
+
+	if _, err := (Analyzer{}).CompareImages(m, pattern(32, 31), 0); err == nil {
+		t.Error("images of different sizes didn't return an error")
+	}
+}
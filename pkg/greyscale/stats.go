@@ -0,0 +1,156 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Stats holds descriptive statistics for the grey values in a Histogram.
+// Values are in the range 0-65535.
+type Stats struct {
+	Pixels   int
+	Min      float64
+	Max      float64
+	Mean     float64
+	Median   float64
+	Mode     float64
+	StdDev   float64
+	Skewness float64
+	// Kurtosis is the excess kurtosis, which is 0 for a normal distribution
+	Kurtosis float64
+	// Unique is the number of bins with at least one pixel
+	Unique int
+}
+
+// ErrNoPixels is returned when statistics are requested for a histogram without any pixels
+var ErrNoPixels = errors.New("no pixels were considered")
+
+// Value returns the grey value that represents bin i, which is the middle of its range
+func (h *Histogram) Value(i int) float64 {
+	lo, hi := h.Range(i)
+	return float64(lo+hi) / 2
+}
+
+// Stats returns descriptive statistics for the histogram.
+// Each pixel is treated as having the value in the middle of its bin,
+// so the statistics are exact when h has Levels bins.
+func (h *Histogram) Stats() (Stats, error) {
+	var s Stats
+	if h.Considered == 0 {
+		return s, ErrNoPixels
+	}
+	s.Pixels = h.Considered
+	n := float64(h.Considered)
+
+	first, last, modeCount := -1, 0, 0
+	var sum float64
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+		s.Unique++
+		if count > modeCount {
+			modeCount = count
+			s.Mode = h.Value(i)
+		}
+		sum += float64(count) * h.Value(i)
+	}
+	s.Min = h.Value(first)
+	s.Max = h.Value(last)
+	s.Mean = sum / n
+
+	// central moments
+	var m2, m3, m4 float64
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		d := h.Value(i) - s.Mean
+		c := float64(count)
+		m2 += c * d * d
+		m3 += c * d * d * d
+		m4 += c * d * d * d * d
+	}
+	m2 /= n
+	m3 /= n
+	m4 /= n
+	s.StdDev = math.Sqrt(m2)
+	if m2 > 0 {
+		s.Skewness = m3 / math.Pow(m2, 1.5)
+		s.Kurtosis = m4/(m2*m2) - 3
+	}
+
+	// the median is the middle value, or the average of the two middle values
+	lower := h.nth((h.Considered - 1) / 2)
+	upper := h.nth(h.Considered / 2)
+	s.Median = (lower + upper) / 2
+
+	return s, nil
+}
+
+// nth returns the value of the pixel at position k (counting from 0) when the pixels are sorted
+func (h *Histogram) nth(k int) float64 {
+	seen := 0
+	for i, count := range h.Counts {
+		seen += count
+		if seen > k {
+			return h.Value(i)
+		}
+	}
+	return h.Value(len(h.Counts) - 1)
+}
+
+// Cumulative returns the running total of the counts, so that
+// element i is the number of pixels in bins 0 through i
+func (h *Histogram) Cumulative() []int {
+	ret := make([]int, len(h.Counts))
+	total := 0
+	for i, count := range h.Counts {
+		total += count
+		ret[i] = total
+	}
+	return ret
+}
+
+// Percentile returns the grey value at percentile p, in the range 0-100.
+// It uses the nearest-rank method, so the result is the smallest value
+// that at least p percent of the pixels are less than or equal to.
+func (h *Histogram) Percentile(p float64) (float64, error) {
+	if h.Considered == 0 {
+		return 0, ErrNoPixels
+	}
+	if p < 0 || p > 100 || math.IsNaN(p) {
+		return 0, fmt.Errorf("percentile %v must be between 0 and 100", p)
+	}
+	k := int(math.Ceil(p*float64(h.Considered)/100)) - 1
+	if k < 0 {
+		k = 0
+	}
+	return h.nth(k), nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package greyscale
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+// near reports whether got and want are within 1e-9 of each other, or both the same infinity
+func near(got, want float64) bool {
+	return got == want || math.Abs(got-want) < 1e-9
+}
+
+func TestStats(t *testing.T) {
+	sixteen, _ := NewHistogram(16)
+	sixteen.Add(0)
+	sixteen.Add(0xffff)
+
+	tests := []struct {
+		name string
+		h    *Histogram
+		want Stats
+	}{
+		{
+			"symmetric",
+			levels(10, 20, 30, 40),
+			Stats{Pixels: 4, Min: 10, Max: 40, Mean: 25, Median: 25, Mode: 10, StdDev: math.Sqrt(125), Skewness: 0, Kurtosis: -1.36, Unique: 4},
+		},
+		{
+			"one value",
+			levels(100, 100, 100),
+			Stats{Pixels: 3, Min: 100, Max: 100, Mean: 100, Median: 100, Mode: 100, Unique: 1},
+		},
+		{
+			// a Bernoulli distribution with p = 1/4
+			"skewed",
+			levels(0, 0, 0, 30),
+			Stats{Pixels: 4, Min: 0, Max: 30, Mean: 7.5, Median: 0, Mode: 0, StdDev: math.Sqrt(168.75), Skewness: 2 / math.Sqrt(3), Kurtosis: -2.0 / 3, Unique: 2},
+		},
+		{
+			"odd count",
+			levels(5, 1, 9, 9, 3),
+			Stats{Pixels: 5, Min: 1, Max: 9, Mean: 5.4, Median: 5, Mode: 9, StdDev: math.Sqrt(10.24), Skewness: -0.03515625, Kurtosis: -1.5810546875, Unique: 4},
+		},
+		{
+			// each pixel counts as the middle of its bin
+			"16 bins",
+			sixteen,
+			Stats{Pixels: 2, Min: 2047.5, Max: 63487.5, Mean: 32767.5, Median: 32767.5, Mode: 2047.5, StdDev: 30720, Skewness: 0, Kurtosis: -2, Unique: 2},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.h.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Pixels != tc.want.Pixels || got.Unique != tc.want.Unique {
+				t.Errorf("pixels and unique are %d and %d, want %d and %d", got.Pixels, got.Unique, tc.want.Pixels, tc.want.Unique)
+			}
+			values := []struct {
+				name      string
+				got, want float64
+			}{
+				{"min", got.Min, tc.want.Min},
+				{"max", got.Max, tc.want.Max},
+				{"mean", got.Mean, tc.want.Mean},
+				{"median", got.Median, tc.want.Median},
+				{"mode", got.Mode, tc.want.Mode},
+				{"standard deviation", got.StdDev, tc.want.StdDev},
+				{"skewness", got.Skewness, tc.want.Skewness},
+				{"kurtosis", got.Kurtosis, tc.want.Kurtosis},
+			}
+			for _, v := range values {
+				if math.Abs(v.got-v.want) > 1e-4 {
+					t.Errorf("%s is %v, want %v", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+
+	if _, err := levels().Stats(); !errors.Is(err, ErrNoPixels) {
+		t.Errorf("the error for an empty histogram is %v, want ErrNoPixels", err)
+	}
+}
+
+func TestCumulative(t *testing.T) {
+	h := &Histogram{Counts: []int{1, 0, 2, 3}, Considered: 6}
+	if got, want := h.Cumulative(), []int{1, 1, 3, 6}; !slices.Equal(got, want) {
+		t.Errorf("Cumulative() = %v, want %v", got, want)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := levels(10, 9, 8, 7, 6, 5, 4, 3, 2, 1)
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 1},
+		{5, 1},
+		{10, 1},
+		{11, 2},
+		{50, 5},
+		{50.1, 6},
+		{90, 9},
+		{99, 10},
+		{100, 10},
+	}
+	for _, tc := range tests {
+		got, err := h.Percentile(tc.p)
+		if err != nil || !near(got, tc.want) {
+			t.Errorf("Percentile(%v) = %v, %v, want %v", tc.p, got, err, tc.want)
+		}
+	}
+
+	for _, p := range []float64{-1, 100.5, math.NaN()} {
+		if _, err := h.Percentile(p); err == nil {
+			t.Errorf("Percentile(%v) didn't return an error", p)
+		}
+	}
+	if _, err := levels().Percentile(50); !errors.Is(err, ErrNoPixels) {
+		t.Errorf("the error for an empty histogram is %v, want ErrNoPixels", err)
+	}
+}
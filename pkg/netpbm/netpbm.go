@@ -0,0 +1,387 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package netpbm decodes PBM, PGM and PPM (Netpbm) images in both their plain (ASCII)
+// and raw (binary) forms, and encodes images as raw PGM or PPM.
+//
+// Importing it registers the decoders with the image package, like image/png does,
+// and registers EncodePGM, EncodePPM and Encode for .pgm, .ppm and .pnm files with greyscale.WriteImage.
+package netpbm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+)
+
+// maxPixels limits the size of the images that are decoded, so a bad header can't use up all memory
+const maxPixels = 1 << 28
+
+func init() {
+	for _, magic := range []string{"P1", "P4"} {
+		image.RegisterFormat("pbm", magic, Decode, DecodeConfig)
+	}
+	for _, magic := range []string{"P2", "P5"} {
+		image.RegisterFormat("pgm", magic, Decode, DecodeConfig)
+	}
+	for _, magic := range []string{"P3", "P6"} {
+		image.RegisterFormat("ppm", magic, Decode, DecodeConfig)
+	}
+	greyscale.RegisterEncoder(".pgm", EncodePGM)
+	greyscale.RegisterEncoder(".ppm", EncodePPM)
+	greyscale.RegisterEncoder(".pnm", Encode)
+}
+
+// header is the start of a Netpbm file
+type header struct {
+	magic         byte // the digit after the P
+	width, height int
+	maxval        int
+}
+
+// plain is true if the samples are written as ASCII numbers
+func (h header) plain() bool { return h.magic <= '3' }
+
+// channels returns the number of samples per pixel
+func (h header) channels() int {
+	if h.magic == '3' || h.magic == '6' {
+		return 3
+	}
+	return 1
+}
+
+func (h header) colorModel() color.Model {
+	switch {
+	case h.channels() == 3 && h.maxval > 255:
+		return color.RGBA64Model
+	case h.channels() == 3:
+		return color.RGBAModel
+	case h.maxval > 255:
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+// reader reads the whitespace-separated parts of a Netpbm file
+type reader struct {
+	*bufio.Reader
+}
+
+// skip skips whitespace and comments, which run from a # to the end of the line
+func (r reader) skip() error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		case '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return err
+			}
+		default:
+			return r.UnreadByte()
+		}
+	}
+}
+
+// number reads an ASCII decimal number
+func (r reader) number() (int, error) {
+	if err := r.skip(); err != nil {
+		return 0, err
+	}
+	n, digits := 0, 0
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c < '0' || c > '9' {
+			if digits == 0 {
+				return 0, fmt.Errorf("netpbm: expected a number, found %q", c)
+			}
+			return n, r.UnreadByte()
+		}
+		if n > 1<<24 {
+			return 0, errors.New("netpbm: number too large")
+		}
+		n = n*10 + int(c-'0')
+		digits++
+	}
+}
+
+func (r reader) header() (header, error) {
+	var h header
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return h, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return h, errors.New("netpbm: not a PBM, PGM or PPM file")
+	}
+	h.magic = magic[1]
+	var err error
+	if h.width, err = r.number(); err != nil {
+		return h, err
+	}
+	if h.height, err = r.number(); err != nil {
+		return h, err
+	}
+	h.maxval = 1
+	if h.magic != '1' && h.magic != '4' {
+		if h.maxval, err = r.number(); err != nil {
+			return h, err
+		}
+	}
+	if h.width < 1 || h.height < 1 || h.width*h.height > maxPixels {
+		return h, fmt.Errorf("netpbm: bad size %dx%d", h.width, h.height)
+	}
+	if h.maxval < 1 || h.maxval > 65535 {
+		return h, fmt.Errorf("netpbm: bad maxval %d", h.maxval)
+	}
+	if !h.plain() {
+		// a single whitespace character separates the header from the raw samples
+		if _, err := r.ReadByte(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a Netpbm image without decoding it
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := reader{bufio.NewReader(r)}.header()
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a Netpbm image. Bitmaps and greymaps become an *image.Gray, or an *image.Gray16
+// if their maxval is more than 255. Pixmaps become an *image.RGBA or *image.RGBA64.
+func Decode(r io.Reader) (image.Image, error) {
+	rd := reader{bufio.NewReader(r)}
+	h, err := rd.header()
+	if err != nil {
+		return nil, err
+	}
+	if h.magic == '1' || h.magic == '4' {
+		return rd.bitmap(h)
+	}
+
+	// samples are scaled from 0-maxval to 0-255, or to 0-65535 for deep images
+	depth := 255
+	if h.maxval > 255 {
+		depth = 65535
+	}
+	sample := func() (int, error) {
+		var v int
+		switch {
+		case h.plain():
+			n, err := rd.number()
+			if err != nil {
+				return 0, err
+			}
+			v = n
+		case h.maxval > 255:
+			hi, err := rd.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			lo, err := rd.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			v = int(hi)<<8 | int(lo)
+		default:
+			b, err := rd.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			v = int(b)
+		}
+		if v > h.maxval {
+			return 0, fmt.Errorf("netpbm: sample %d is more than maxval %d", v, h.maxval)
+		}
+		return (v*depth + h.maxval/2) / h.maxval, nil
+	}
+
+	bounds := image.Rect(0, 0, h.width, h.height)
+	var set func(x, y int, s []int)
+	var m image.Image
+	switch h.colorModel() {
+	case color.GrayModel:
+		g := image.NewGray(bounds)
+		set = func(x, y int, s []int) { g.Pix[y*g.Stride+x] = uint8(s[0]) }
+		m = g
+	case color.Gray16Model:
+		g := image.NewGray16(bounds)
+		set = func(x, y int, s []int) { g.SetGray16(x, y, color.Gray16{uint16(s[0])}) }
+		m = g
+	case color.RGBAModel:
+		c := image.NewRGBA(bounds)
+		set = func(x, y int, s []int) { c.SetRGBA(x, y, color.RGBA{uint8(s[0]), uint8(s[1]), uint8(s[2]), 0xff}) }
+		m = c
+	default:
+		c := image.NewRGBA64(bounds)
+		set = func(x, y int, s []int) {
+			c.SetRGBA64(x, y, color.RGBA64{uint16(s[0]), uint16(s[1]), uint16(s[2]), 0xffff})
+		}
+		m = c
+	}
+	s := make([]int, h.channels())
+	for y := 0; y < h.height; y++ {
+		for x := 0; x < h.width; x++ {
+			for i := range s {
+				if s[i], err = sample(); err != nil {
+					return nil, unexpected(err)
+				}
+			}
+			set(x, y, s)
+		}
+	}
+	return m, nil
+}
+
+// bitmap reads the pixels of a PBM image, where 1 is black and 0 is white
+func (r reader) bitmap(h header) (image.Image, error) {
+	g := image.NewGray(image.Rect(0, 0, h.width, h.height))
+	if h.plain() {
+		// the bits may or may not be separated by whitespace
+		for i := range g.Pix {
+			if err := r.skip(); err != nil {
+				return nil, unexpected(err)
+			}
+			c, err := r.ReadByte()
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			if c != '0' && c != '1' {
+				return nil, fmt.Errorf("netpbm: bad bit %q", c)
+			}
+			if c == '0' {
+				g.Pix[i] = 0xff
+			}
+		}
+		return g, nil
+	}
+	// each row is packed 8 pixels to a byte, high bit first
+	row := make([]byte, (h.width+7)/8)
+	for y := 0; y < h.height; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, unexpected(err)
+		}
+		for x := 0; x < h.width; x++ {
+			if row[x/8]&(0x80>>(x%8)) == 0 {
+				g.Pix[y*g.Stride+x] = 0xff
+			}
+		}
+	}
+	return g, nil
+}
+
+// unexpected reports a file that ends too soon as a format error
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Encode writes m as a raw PGM (P5) image if its color model is grey, or as a raw PPM (P6) image
+// otherwise. The samples are 16 bits if the color model has more than 8 bits (see greyscale.BitDepth).
+func Encode(w io.Writer, m image.Image) error {
+	return encode(w, m, !isGrey(m.ColorModel()))
+}
+
+// EncodePGM writes m as a raw (P5) PGM image. It returns an error if m has a color model
+// that isn't grey, rather than losing its colors.
+func EncodePGM(w io.Writer, m image.Image) error {
+	if !isGrey(m.ColorModel()) {
+		return fmt.Errorf("netpbm: can't write an image with the %s color model as a PGM, which only has greys", greyscale.ColorModelName(m.ColorModel()))
+	}
+	return encode(w, m, false)
+}
+
+// EncodePPM writes m as a raw (P6) PPM image, even if it's grey
+func EncodePPM(w io.Writer, m image.Image) error {
+	return encode(w, m, true)
+}
+
+// isGrey reports whether every color in the model is a grey: a grey model, or a palette of greys
+func isGrey(model color.Model) bool {
+	switch model := model.(type) {
+	case color.Palette:
+		for _, c := range model {
+			r, g, b, _ := c.RGBA()
+			if r != g || g != b {
+				return false
+			}
+		}
+		return true
+	default:
+		return model == color.GrayModel || model == color.Gray16Model
+	}
+}
+
+// encode writes m as a raw PPM (P6) image if rgb is set, or a raw PGM (P5) image if it isn't
+func encode(w io.Writer, m image.Image, rgb bool) error {
+	bounds := m.Bounds()
+	maxval := 255
+	if greyscale.BitDepth(m) == 16 {
+		maxval = 65535
+	}
+	bw := bufio.NewWriter(w)
+	// sample writes the top 8 bits of v, or all 16 bits if the image is that deep
+	sample := func(v uint32) {
+		bw.WriteByte(uint8(v >> 8))
+		if maxval > 255 {
+			bw.WriteByte(uint8(v))
+		}
+	}
+	magic := "P5"
+	if rgb {
+		magic = "P6"
+	}
+	fmt.Fprintf(bw, "%s\n%d %d\n%d\n", magic, bounds.Dx(), bounds.Dy(), maxval)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !rgb {
+				sample(uint32(color.Gray16Model.Convert(m.At(x, y)).(color.Gray16).Y))
+				continue
+			}
+			r, g, b, _ := m.At(x, y).RGBA()
+			sample(r)
+			sample(g)
+			sample(b)
+		}
+	}
+	return bw.Flush()
+}
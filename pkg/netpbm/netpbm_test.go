@@ -0,0 +1,273 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package netpbm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+// netpbm makes an image file with the given samples, in reading order.
+// For bitmaps, 1 is black.
+func netpbm(magic string, w, h, maxval int, samples []int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n# made for testing\n%d %d\n", magic, w, h)
+	if magic != "P1" && magic != "P4" {
+		fmt.Fprintf(&b, "%d\n", maxval)
+	}
+	switch magic {
+	case "P1", "P2", "P3":
+		for i, s := range samples {
+			fmt.Fprintf(&b, "%d", s)
+			if i%5 == 4 {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+	case "P4":
+		for y := 0; y < h; y++ {
+			row := make([]byte, (w+7)/8)
+			for x := 0; x < w; x++ {
+				if samples[y*w+x] == 1 {
+					row[x/8] |= 0x80 >> (x % 8)
+				}
+			}
+			b.Write(row)
+		}
+	default:
+		for _, s := range samples {
+			if maxval > 255 {
+				b.WriteByte(byte(s >> 8))
+			}
+			b.WriteByte(byte(s))
+		}
+	}
+	return b.Bytes()
+}
+
+func gray(w, h int, pix ...uint8) *image.Gray {
+	return &image.Gray{Pix: pix, Stride: w, Rect: image.Rect(0, 0, w, h)}
+}
+
+func gray16(w, h int, pix ...uint16) *image.Gray16 {
+	m := image.NewGray16(image.Rect(0, 0, w, h))
+	for i, v := range pix {
+		m.SetGray16(i%w, i/w, color.Gray16{v})
+	}
+	return m
+}
+
+// sameImage fails the test unless got has the same bounds, color model and pixels as want
+func sameImage(t *testing.T, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds are %v, want %v", got.Bounds(), want.Bounds())
+	}
+	if got.ColorModel() != want.ColorModel() {
+		t.Fatalf("color model is %T, want %T", got, want)
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.RGBA64Model.Convert(got.At(x, y))
+			w := color.RGBA64Model.Convert(want.At(x, y))
+			if g != w {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	// a 10 pixel wide bitmap has rows that end part way through a byte
+	bits := make([]int, 20)
+	wantBits := make([]uint8, 20)
+	for i := range bits {
+		if i%3 == 0 {
+			bits[i] = 1
+		} else {
+			wantBits[i] = 0xff
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want image.Image
+	}{
+		{"P1", netpbm("P1", 3, 2, 1, []int{1, 0, 1, 0, 1, 0}), gray(3, 2, 0, 255, 0, 255, 0, 255)},
+		{"P1 without spaces", []byte("P1 3 1\n101"), gray(3, 1, 0, 255, 0)},
+		{"P4", netpbm("P4", 10, 2, 1, bits), gray(10, 2, wantBits...)},
+		{"P2", netpbm("P2", 3, 1, 255, []int{0, 128, 255}), gray(3, 1, 0, 128, 255)},
+		{"P2 maxval 15", netpbm("P2", 3, 1, 15, []int{0, 7, 15}), gray(3, 1, 0, 119, 255)},
+		{"P2 maxval 1000", netpbm("P2", 3, 1, 1000, []int{0, 500, 1000}), gray16(3, 1, 0, 32768, 65535)},
+		{"P5", netpbm("P5", 2, 2, 255, []int{0, 1, 254, 255}), gray(2, 2, 0, 1, 254, 255)},
+		{"P5 maxval 65535", netpbm("P5", 2, 2, 65535, []int{0, 258, 65279, 65535}), gray16(2, 2, 0, 258, 65279, 65535)},
+		{"P5 maxval 4095", netpbm("P5", 2, 1, 4095, []int{0, 4095}), gray16(2, 1, 0, 65535)},
+		{
+			"P3",
+			netpbm("P3", 2, 1, 255, []int{255, 0, 0, 1, 2, 3}),
+			&image.RGBA{Pix: []uint8{255, 0, 0, 255, 1, 2, 3, 255}, Stride: 8, Rect: image.Rect(0, 0, 2, 1)},
+		},
+		{
+			"P3 maxval 65535",
+			netpbm("P3", 1, 1, 65535, []int{0, 0x8000, 65535}),
+			&image.RGBA64{Pix: []uint8{0, 0, 0x80, 0, 0xff, 0xff, 0xff, 0xff}, Stride: 8, Rect: image.Rect(0, 0, 1, 1)},
+		},
+		{
+			"P6",
+			netpbm("P6", 1, 2, 255, []int{10, 20, 30, 40, 50, 60}),
+			&image.RGBA{Pix: []uint8{10, 20, 30, 255, 40, 50, 60, 255}, Stride: 4, Rect: image.Rect(0, 0, 1, 2)},
+		},
+		{
+			"P6 maxval 65535",
+			netpbm("P6", 1, 1, 65535, []int{0x1234, 0x5678, 0x9abc}),
+			&image.RGBA64{Pix: []uint8{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xff, 0xff}, Stride: 8, Rect: image.Rect(0, 0, 1, 1)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Decode(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameImage(t, m, tc.want)
+
+			cfg, err := DecodeConfig(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := tc.want.Bounds()
+			if cfg.Width != b.Dx() || cfg.Height != b.Dy() || cfg.ColorModel != tc.want.ColorModel() {
+				t.Errorf("config is %dx%d %v, want %dx%d %v", cfg.Width, cfg.Height, cfg.ColorModel, b.Dx(), b.Dy(), tc.want.ColorModel())
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	deep := netpbm("P5", 2, 1, 65535, []int{1, 2})
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not netpbm", []byte("GIF89a"), "not a PBM"},
+		{"bad maxval", []byte("P5 1 1 0\n\x00"), "bad maxval"},
+		{"maxval too big", []byte("P5 1 1 65536\n\x00\x00"), "bad maxval"},
+		{"bad size", []byte("P5 0 1 255\n"), "bad size"},
+		{"sample too big", []byte("P2 2 1 15\n3 16\n"), "more than maxval"},
+		{"bad bit", []byte("P1 2 1\n1 2\n"), "bad bit"},
+		{"too short", netpbm("P5", 2, 2, 255, []int{1, 2, 3}), "unexpected EOF"},
+		{"half a 16-bit sample", deep[:len(deep)-1], "unexpected EOF"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error is %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		enc   func(io.Writer, image.Image) error
+		m     image.Image
+		magic string
+		want  image.Image
+	}{
+		{"8-bit", Encode, gray(3, 2, 0, 1, 2, 127, 254, 255), "P5", gray(3, 2, 0, 1, 2, 127, 254, 255)},
+		{"16-bit", Encode, gray16(2, 2, 0, 1, 0x1234, 65535), "P5", gray16(2, 2, 0, 1, 0x1234, 65535)},
+		{
+			"grey palette",
+			Encode,
+			&image.Paletted{Pix: []uint8{1, 0}, Stride: 2, Rect: image.Rect(0, 0, 2, 1), Palette: color.Palette{color.Gray{0}, color.Gray{200}}},
+			"P5",
+			gray(2, 1, 200, 0),
+		},
+		{
+			"color",
+			Encode,
+			&image.RGBA{Pix: []uint8{255, 0, 0, 255, 1, 2, 3, 255}, Stride: 8, Rect: image.Rect(0, 0, 2, 1)},
+			"P6",
+			&image.RGBA{Pix: []uint8{255, 0, 0, 255, 1, 2, 3, 255}, Stride: 8, Rect: image.Rect(0, 0, 2, 1)},
+		},
+		{
+			"16-bit color",
+			Encode,
+			&image.RGBA64{Pix: []uint8{0x12, 0x34, 0, 0, 0xff, 0xff, 0xff, 0xff}, Stride: 8, Rect: image.Rect(0, 0, 1, 1)},
+			"P6",
+			&image.RGBA64{Pix: []uint8{0x12, 0x34, 0, 0, 0xff, 0xff, 0xff, 0xff}, Stride: 8, Rect: image.Rect(0, 0, 1, 1)},
+		},
+		{
+			"grey as PPM",
+			EncodePPM,
+			gray(2, 1, 9, 200),
+			"P6",
+			&image.RGBA{Pix: []uint8{9, 9, 9, 255, 200, 200, 200, 255}, Stride: 8, Rect: image.Rect(0, 0, 2, 1)},
+		},
+		{
+			"offset bounds",
+			EncodePGM,
+			&image.Gray{Pix: []uint8{9, 8, 7, 6}, Stride: 2, Rect: image.Rect(5, 5, 7, 7)},
+			"P5",
+			gray(2, 2, 9, 8, 7, 6),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tc.enc(&b, tc.m); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(b.Bytes(), []byte(tc.magic+"\n")) {
+				t.Fatalf("the file starts with %q, want %s", b.Bytes()[:2], tc.magic)
+			}
+			m, err := Decode(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameImage(t, m, tc.want)
+		})
+	}
+}
+
+func TestEncodePGMColor(t *testing.T) {
+	m := &image.RGBA{Pix: []uint8{255, 0, 0, 255}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)}
+	var b bytes.Buffer
+	err := EncodePGM(&b, m)
+	if err == nil || !strings.Contains(err.Error(), "RGBA") {
+		t.Errorf("writing a color image as a PGM returned %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("%d bytes were written", b.Len())
+	}
+}
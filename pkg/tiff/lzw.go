@@ -0,0 +1,88 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package tiff
+
+import "errors"
+
+// LZW codes with a special meaning
+const (
+	lzwClear = 256
+	lzwEnd   = 257
+)
+
+// unLZW decompresses TIFF-flavored LZW data, stopping after size bytes. Unlike compress/lzw,
+// the codes get wider one code early, which is how every TIFF writer does it.
+func unLZW(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	var table [][]byte
+	var prev []byte
+	width := 9
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		// the clear and end codes have no entries
+		table = append(table, nil, nil)
+		prev = nil
+		width = 9
+	}
+	table = make([][]byte, 0, 4096)
+	reset()
+
+	// codes are packed high bits first
+	bit := 0
+	for len(out) < size && bit+width <= len(src)*8 {
+		code := 0
+		for i := 0; i < width; i++ {
+			code = code<<1 | int(src[bit/8]>>(7-bit%8))&1
+			bit++
+		}
+
+		if code == lzwClear {
+			reset()
+			continue
+		}
+		if code == lzwEnd {
+			break
+		}
+		var entry []byte
+		switch {
+		case code < len(table) && code != lzwClear && code != lzwEnd:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			// the code being defined right now: the previous string and its own first byte
+			entry = append(append([]byte(nil), prev...), prev[0])
+		default:
+			return nil, errors.New("lzw: bad code")
+		}
+		out = append(out, entry...)
+		if prev != nil && len(table) < 4096 {
+			table = append(table, append(append([]byte(nil), prev...), entry[0]))
+		}
+		prev = entry
+		if len(table) >= 1<<width-1 && width < 12 {
+			width++
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,511 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package tiff decodes greyscale TIFF images, including multi-page files.
+//
+// It reads 1, 2, 4, 8, 16 and 32-bit samples (unsigned, signed or floating point) with
+// either photometric interpretation (MinIsBlack or MinIsWhite), stored in strips or tiles,
+// uncompressed or compressed with PackBits, LZW or Deflate. Importing it registers the
+// decoder with the image package, like image/png does.
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/rahji/greyscale/pkg/greyscale"
+)
+
+func init() {
+	image.RegisterFormat("tiff", "II*\x00", Decode, DecodeConfig)
+	image.RegisterFormat("tiff", "MM\x00*", Decode, DecodeConfig)
+	greyscale.RegisterPageDecoder("tiff", DecodePages)
+}
+
+// tags that the decoder uses
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPlanarConfig    = 284
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+)
+
+// compression schemes
+const (
+	compressionNone     = 1
+	compressionLZW      = 5
+	compressionDeflate  = 8
+	compressionPackBits = 32773
+	// compressionOldDeflate is the code that was used for Deflate before it was standardized
+	compressionOldDeflate = 32946
+)
+
+// sample formats
+const (
+	sampleUnsigned = 1
+	sampleSigned   = 2
+	sampleFloat    = 3
+)
+
+// maxPixels limits the size of the images that are decoded, so a bad header can't use up all memory
+const maxPixels = 1 << 28
+
+// maxPages limits the number of pages, so a file whose pages form a loop can't be read forever
+const maxPages = 1 << 16
+
+// typeSizes is the size in bytes of each TIFF field type, by type number
+var typeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// file is a TIFF file that has been read into memory
+type file struct {
+	data  []byte
+	order binary.ByteOrder
+	ifds  []ifd
+}
+
+// ifd is an image file directory, which describes one page. It maps tags to their values.
+type ifd map[uint16][]uint
+
+func parse(r io.Reader) (*file, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, errors.New("tiff: file is too short")
+	}
+	f := &file{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		f.order = binary.LittleEndian
+	case "MM\x00*":
+		f.order = binary.BigEndian
+	default:
+		return nil, errors.New("tiff: not a TIFF file (BigTIFF isn't supported)")
+	}
+
+	seen := map[uint32]bool{}
+	for offset := f.order.Uint32(data[4:8]); offset != 0; {
+		if seen[offset] || len(f.ifds) >= maxPages {
+			return nil, errors.New("tiff: the pages form a loop")
+		}
+		seen[offset] = true
+		d, next, err := f.ifd(offset)
+		if err != nil {
+			return nil, err
+		}
+		f.ifds = append(f.ifds, d)
+		offset = next
+	}
+	if len(f.ifds) == 0 {
+		return nil, errors.New("tiff: the file has no pages")
+	}
+	return f, nil
+}
+
+// ifd reads the image file directory at offset, and returns the offset of the next one
+func (f *file) ifd(offset uint32) (ifd, uint32, error) {
+	if uint64(offset)+2 > uint64(len(f.data)) {
+		return nil, 0, errors.New("tiff: bad directory offset")
+	}
+	n := int(f.order.Uint16(f.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12+4 > len(f.data) {
+		return nil, 0, errors.New("tiff: directory runs past the end of the file")
+	}
+	d := ifd{}
+	for i := 0; i < n; i++ {
+		entry := f.data[start+i*12 : start+i*12+12]
+		tag := f.order.Uint16(entry)
+		typ := int(f.order.Uint16(entry[2:]))
+		count := int(f.order.Uint32(entry[4:]))
+		if typ >= len(typeSizes) || typeSizes[typ] == 0 {
+			// unknown types can be skipped
+			continue
+		}
+		size := typeSizes[typ] * count
+		if count < 0 || size < 0 || size > len(f.data) {
+			return nil, 0, fmt.Errorf("tiff: bad count for tag %d", tag)
+		}
+		value := entry[8:12]
+		if size > 4 {
+			o := int(f.order.Uint32(value))
+			if o < 0 || o+size > len(f.data) {
+				return nil, 0, fmt.Errorf("tiff: tag %d runs past the end of the file", tag)
+			}
+			value = f.data[o : o+size]
+		}
+		// only integer values are needed
+		var vals []uint
+		for j := 0; j < count; j++ {
+			switch typ {
+			case 1, 6, 7:
+				vals = append(vals, uint(value[j]))
+			case 3, 8:
+				vals = append(vals, uint(f.order.Uint16(value[j*2:])))
+			case 4, 9:
+				vals = append(vals, uint(f.order.Uint32(value[j*4:])))
+			}
+		}
+		d[tag] = vals
+	}
+	return d, f.order.Uint32(f.data[start+n*12:]), nil
+}
+
+// get returns the first value of a tag, or def if it isn't there
+func (d ifd) get(tag uint16, def uint) uint {
+	if v := d[tag]; len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
+
+// page describes the layout of the pixels of one page
+type page struct {
+	width, height int
+	bits          int
+	format        int
+	minIsWhite    bool
+	compression   int
+	predictor     int
+	// the pixels are stored in chunks (strips or tiles), each chunkWidth by chunkHeight
+	chunkWidth, chunkHeight int
+	offsets, counts         []uint
+}
+
+func (f *file) page(d ifd) (*page, error) {
+	p := &page{
+		width:       int(d.get(tagImageWidth, 0)),
+		height:      int(d.get(tagImageLength, 0)),
+		bits:        int(d.get(tagBitsPerSample, 1)),
+		format:      int(d.get(tagSampleFormat, sampleUnsigned)),
+		compression: int(d.get(tagCompression, compressionNone)),
+		predictor:   int(d.get(tagPredictor, 1)),
+	}
+	if p.width < 1 || p.height < 1 || p.width > maxPixels/p.height {
+		return nil, fmt.Errorf("tiff: bad size %dx%d", p.width, p.height)
+	}
+	if spp := d.get(tagSamplesPerPixel, 1); spp != 1 {
+		return nil, fmt.Errorf("tiff: only greyscale images can be read, but this one has %d samples per pixel", spp)
+	}
+	switch d.get(tagPhotometric, 1) {
+	case 0:
+		p.minIsWhite = true
+	case 1:
+	default:
+		return nil, fmt.Errorf("tiff: only greyscale images can be read, but this one has photometric interpretation %d", d.get(tagPhotometric, 1))
+	}
+	switch {
+	case p.format == sampleFloat && p.bits == 32:
+	case p.format == sampleSigned:
+		switch p.bits {
+		case 8, 16, 32:
+		default:
+			return nil, fmt.Errorf("tiff: %d-bit signed samples aren't supported", p.bits)
+		}
+	case p.format == sampleUnsigned:
+		switch p.bits {
+		case 1, 2, 4, 8, 16, 32:
+		default:
+			return nil, fmt.Errorf("tiff: %d-bit samples aren't supported", p.bits)
+		}
+	default:
+		return nil, fmt.Errorf("tiff: %d-bit samples of format %d aren't supported", p.bits, p.format)
+	}
+	switch p.compression {
+	case compressionNone, compressionLZW, compressionDeflate, compressionOldDeflate, compressionPackBits:
+	default:
+		return nil, fmt.Errorf("tiff: compression %d isn't supported", p.compression)
+	}
+	if p.predictor != 1 && (p.predictor != 2 || p.bits < 8 || p.format == sampleFloat) {
+		return nil, fmt.Errorf("tiff: predictor %d isn't supported for %d-bit samples", p.predictor, p.bits)
+	}
+
+	if _, tiled := d[tagTileOffsets]; tiled {
+		p.chunkWidth = int(d.get(tagTileWidth, 0))
+		p.chunkHeight = int(d.get(tagTileLength, 0))
+		p.offsets, p.counts = d[tagTileOffsets], d[tagTileByteCounts]
+	} else {
+		p.chunkWidth = p.width
+		p.chunkHeight = int(min(d.get(tagRowsPerStrip, uint(p.height)), uint(p.height)))
+		p.offsets, p.counts = d[tagStripOffsets], d[tagStripByteCounts]
+	}
+	if p.chunkWidth < 1 || p.chunkHeight < 1 || p.chunkWidth > maxPixels/p.chunkHeight {
+		return nil, fmt.Errorf("tiff: bad strip or tile size %dx%d", p.chunkWidth, p.chunkHeight)
+	}
+	across := (p.width + p.chunkWidth - 1) / p.chunkWidth
+	down := (p.height + p.chunkHeight - 1) / p.chunkHeight
+	if len(p.offsets) < across*down || len(p.counts) < across*down {
+		return nil, errors.New("tiff: missing strip or tile offsets")
+	}
+	return p, nil
+}
+
+func (p *page) colorModel() color.Model {
+	if p.bits > 8 {
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+// decode reads the pixels of a page
+func (f *file) decode(d ifd) (image.Image, error) {
+	p, err := f.page(d)
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, p.width, p.height)
+	var set func(x, y int, v uint32)
+	var m image.Image
+	if p.bits > 8 {
+		g := image.NewGray16(bounds)
+		set = func(x, y int, v uint32) { g.SetGray16(x, y, color.Gray16{uint16(v)}) }
+		m = g
+	} else {
+		g := image.NewGray(bounds)
+		set = func(x, y int, v uint32) { g.Pix[y*g.Stride+x] = uint8(v) }
+		m = g
+	}
+
+	rowBytes := (p.chunkWidth*p.bits + 7) / 8
+	across := (p.width + p.chunkWidth - 1) / p.chunkWidth
+	for i := 0; i < len(p.offsets) && i < len(p.counts); i++ {
+		x0, y0 := i%across*p.chunkWidth, i/across*p.chunkHeight
+		if y0 >= p.height {
+			break
+		}
+		// the last strip may be shorter than the others
+		rows := p.chunkHeight
+		if p.chunkWidth == p.width {
+			rows = min(rows, p.height-y0)
+		}
+		chunk, err := f.chunk(p, i, rows*rowBytes)
+		if err != nil {
+			return nil, err
+		}
+		for r := 0; r < rows && y0+r < p.height; r++ {
+			row := chunk[r*rowBytes : (r+1)*rowBytes]
+			if p.predictor == 2 {
+				undoPredictor(row, p.bits/8, f.order)
+			}
+			for c := 0; c < p.chunkWidth && x0+c < p.width; c++ {
+				set(x0+c, y0+r, p.sample(row, c, f.order))
+			}
+		}
+	}
+	return m, nil
+}
+
+// chunk returns the decompressed bytes of strip or tile i, padded with zeros to size bytes
+func (f *file) chunk(p *page, i, size int) ([]byte, error) {
+	off, n := p.offsets[i], p.counts[i]
+	if off > uint(len(f.data)) || n > uint(len(f.data))-off {
+		return nil, errors.New("tiff: strip or tile runs past the end of the file")
+	}
+	raw := f.data[off : off+n]
+	var out []byte
+	var err error
+	switch p.compression {
+	case compressionNone:
+		out = raw
+		if p.predictor == 2 {
+			// the predictor is undone in place, which mustn't change the file's data
+			out = bytes.Clone(raw)
+		}
+	case compressionPackBits:
+		out, err = unpackBits(raw, size)
+	case compressionLZW:
+		out, err = unLZW(raw, size)
+	case compressionDeflate, compressionOldDeflate:
+		var zr io.ReadCloser
+		zr, err = zlib.NewReader(bytes.NewReader(raw))
+		if err == nil {
+			out, err = io.ReadAll(io.LimitReader(zr, int64(size)))
+			zr.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tiff: strip or tile %d: %w", i, err)
+	}
+	if len(out) < size {
+		// some writers leave off the end of the last strip
+		out = append(append([]byte(nil), out...), make([]byte, size-len(out))...)
+	}
+	return out, nil
+}
+
+// undoPredictor reverses horizontal differencing, where each sample is stored as its
+// difference from the one before it
+func undoPredictor(row []byte, size int, order binary.ByteOrder) {
+	switch size {
+	case 1:
+		for i := 1; i < len(row); i++ {
+			row[i] += row[i-1]
+		}
+	case 2:
+		for i := 2; i+1 < len(row); i += 2 {
+			order.PutUint16(row[i:], order.Uint16(row[i:])+order.Uint16(row[i-2:]))
+		}
+	case 4:
+		for i := 4; i+3 < len(row); i += 4 {
+			order.PutUint32(row[i:], order.Uint32(row[i:])+order.Uint32(row[i-4:]))
+		}
+	}
+}
+
+// sample returns sample c of a row, scaled to 0-255 for up to 8 bits or 0-65535 for more
+func (p *page) sample(row []byte, c int, order binary.ByteOrder) uint32 {
+	var v, max uint32
+	switch p.bits {
+	case 8:
+		v, max = uint32(row[c]), 0xff
+	case 16:
+		v, max = uint32(order.Uint16(row[c*2:])), 0xffff
+	case 32:
+		v, max = order.Uint32(row[c*4:]), 0xffff
+		switch p.format {
+		case sampleFloat:
+			// floating point samples are expected to be in the range 0-1
+			f := float64(math.Float32frombits(v))
+			if math.IsNaN(f) {
+				f = 0
+			}
+			v = uint32(math.Round(math.Max(0, math.Min(f, 1)) * 0xffff))
+		case sampleSigned:
+			v = (v ^ 0x80000000) >> 16
+		default:
+			v >>= 16
+		}
+	default:
+		// 1, 2 or 4 bits, packed high bits first
+		bit := c * p.bits
+		v = uint32(row[bit/8]>>(8-p.bits-bit%8)) & (1<<p.bits - 1)
+		v = v * 0xff / (1<<p.bits - 1)
+		max = 0xff
+	}
+	if p.format == sampleSigned && (p.bits == 8 || p.bits == 16) {
+		// flipping the sign bit turns a two's complement number into an offset one
+		v ^= (max + 1) / 2
+	}
+	if p.minIsWhite {
+		v = max - v
+	}
+	return v
+}
+
+// unpackBits decompresses PackBits data, stopping after size bytes
+func unpackBits(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(src) && len(out) < size; {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return nil, errors.New("packbits: literal runs past the end of the data")
+			}
+			out = append(out, src[i:i+n+1]...)
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, errors.New("packbits: missing repeated byte")
+			}
+			for j := 0; j < 1-n; j++ {
+				out = append(out, src[i])
+			}
+			i++
+		}
+	}
+	return out, nil
+}
+
+// DecodeConfig returns the color model and dimensions of the first page of a TIFF image
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	f, err := parse(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	p, err := f.page(f.ifds[0])
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: p.colorModel(), Width: p.width, Height: p.height}, nil
+}
+
+// Decode reads the first page of a TIFF image. Images with up to 8 bits per sample become an
+// *image.Gray, and deeper ones become an *image.Gray16. MinIsWhite images are inverted so that
+// 0 is always black.
+func Decode(r io.Reader) (image.Image, error) {
+	f, err := parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.decode(f.ifds[0])
+}
+
+// DecodePages reads the pages of a TIFF image with the given indexes, counting from 0,
+// or every page if pages is nil. It also returns the number of pages in the file.
+func DecodePages(r io.Reader, pages []int) ([]image.Image, int, error) {
+	f, err := parse(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	n := len(f.ifds)
+	if pages == nil {
+		for i := range f.ifds {
+			pages = append(pages, i)
+		}
+	}
+	var ret []image.Image
+	for _, i := range pages {
+		if i < 0 || i >= n {
+			if n == 1 {
+				return nil, n, fmt.Errorf("there is no page %d, the file has 1 page", i+1)
+			}
+			return nil, n, fmt.Errorf("there is no page %d, the file has %d pages", i+1, n)
+		}
+		m, err := f.decode(f.ifds[i])
+		if err != nil {
+			return nil, n, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		ret = append(ret, m)
+	}
+	return ret, n, nil
+}
@@ -0,0 +1,603 @@
+/*
+Copyright © 2024 Rob Duarte <me@robduarte.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testPage describes a page for tiffFile to write
+type testPage struct {
+	width, height int
+	bits          int
+	format        int // 0 for unsigned
+	minIsWhite    bool
+	compression   int // 0 for none
+	predictor     int // 0 for none
+	rowsPerStrip  int // 0 for one strip
+	tile          int // the width and height of square tiles, or 0 for strips
+	spp           int // samples per pixel, 0 for 1
+	// samples are the stored values, in reading order
+	samples []uint32
+}
+
+// byteOrder is binary.LittleEndian or binary.BigEndian
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffFile writes a TIFF file with the pages in the given byte order
+func tiffFile(order byteOrder, pages ...testPage) []byte {
+	var b []byte
+	if order == binary.LittleEndian {
+		b = []byte("II*\x00")
+	} else {
+		b = []byte("MM\x00*")
+	}
+	next := len(b)
+	b = order.AppendUint32(b, 0)
+
+	for _, p := range pages {
+		if p.compression == 0 {
+			p.compression = compressionNone
+		}
+		var offsets, counts []uint32
+		for _, c := range p.chunks(order) {
+			offsets = append(offsets, uint32(len(b)))
+			counts = append(counts, uint32(len(c)))
+			b = append(b, c...)
+		}
+
+		type entry struct {
+			tag  uint16
+			typ  uint16
+			vals []uint32
+		}
+		short := func(tag uint16, v int) entry { return entry{tag, 3, []uint32{uint32(v)}} }
+		long := func(tag uint16, v ...uint32) entry { return entry{tag, 4, v} }
+		photometric := 1
+		if p.minIsWhite {
+			photometric = 0
+		}
+		entries := []entry{
+			long(tagImageWidth, uint32(p.width)),
+			long(tagImageLength, uint32(p.height)),
+			short(tagBitsPerSample, p.bits),
+			short(tagCompression, p.compression),
+			short(tagPhotometric, photometric),
+		}
+		if p.spp != 0 {
+			entries = append(entries, short(tagSamplesPerPixel, p.spp))
+		}
+		if p.format != 0 {
+			entries = append(entries, short(tagSampleFormat, p.format))
+		}
+		if p.predictor != 0 {
+			entries = append(entries, short(tagPredictor, p.predictor))
+		}
+		if p.tile != 0 {
+			entries = append(entries, short(tagTileWidth, p.tile), short(tagTileLength, p.tile),
+				long(tagTileOffsets, offsets...), long(tagTileByteCounts, counts...))
+		} else {
+			entries = append(entries, long(tagStripOffsets, offsets...), long(tagStripByteCounts, counts...))
+			if p.rowsPerStrip != 0 {
+				entries = append(entries, long(tagRowsPerStrip, uint32(p.rowsPerStrip)))
+			}
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return int(a.tag) - int(b.tag) })
+
+		// values that don't fit in an entry go before the directory
+		outside := map[uint16]uint32{}
+		for _, e := range entries {
+			if len(e.vals) > 1 {
+				outside[e.tag] = uint32(len(b))
+				for _, v := range e.vals {
+					b = order.AppendUint32(b, v)
+				}
+			}
+		}
+		if len(b)%2 == 1 {
+			b = append(b, 0)
+		}
+		order.PutUint32(b[next:], uint32(len(b)))
+		b = order.AppendUint16(b, uint16(len(entries)))
+		for _, e := range entries {
+			b = order.AppendUint16(b, e.tag)
+			b = order.AppendUint16(b, e.typ)
+			b = order.AppendUint32(b, uint32(len(e.vals)))
+			switch {
+			case len(e.vals) > 1:
+				b = order.AppendUint32(b, outside[e.tag])
+			case e.typ == 3:
+				b = order.AppendUint16(b, uint16(e.vals[0]))
+				b = order.AppendUint16(b, 0)
+			default:
+				b = order.AppendUint32(b, e.vals[0])
+			}
+		}
+		next = len(b)
+		b = order.AppendUint32(b, 0)
+	}
+	return b
+}
+
+// chunks returns the compressed strips or tiles of the page
+func (p testPage) chunks(order binary.ByteOrder) [][]byte {
+	w, h := p.width, p.height
+	if p.rowsPerStrip != 0 {
+		h = p.rowsPerStrip
+	}
+	if p.tile != 0 {
+		w, h = p.tile, p.tile
+	}
+	var chunks [][]byte
+	for y0 := 0; y0 < p.height; y0 += h {
+		for x0 := 0; x0 < p.width; x0 += w {
+			var data []byte
+			for y := y0; y < y0+h; y++ {
+				if p.tile == 0 && y >= p.height {
+					// the last strip is short
+					break
+				}
+				row := make([]byte, (w*p.bits+7)/8)
+				for x := x0; x < x0+w; x++ {
+					// tiles are padded with zeros past the edges of the image
+					if x < p.width && y < p.height {
+						putSample(row, x-x0, p.bits, p.samples[y*p.width+x], order)
+					}
+				}
+				if p.predictor == 2 && p.bits >= 8 {
+					size := p.bits / 8
+					for i := len(row) - size; i >= size; i -= size {
+						switch size {
+						case 1:
+							row[i] -= row[i-1]
+						case 2:
+							order.PutUint16(row[i:], order.Uint16(row[i:])-order.Uint16(row[i-2:]))
+						case 4:
+							order.PutUint32(row[i:], order.Uint32(row[i:])-order.Uint32(row[i-4:]))
+						}
+					}
+				}
+				data = append(data, row...)
+			}
+			chunks = append(chunks, compress(p.compression, data))
+		}
+	}
+	return chunks
+}
+
+func putSample(row []byte, c, bits int, v uint32, order binary.ByteOrder) {
+	switch bits {
+	case 8:
+		row[c] = uint8(v)
+	case 16:
+		order.PutUint16(row[c*2:], uint16(v))
+	case 32:
+		order.PutUint32(row[c*4:], v)
+	case 1, 2, 4:
+		bit := c * bits
+		row[bit/8] |= uint8(v) << (8 - bits - bit%8)
+	}
+}
+
+func compress(compression int, data []byte) []byte {
+	switch compression {
+	case compressionPackBits:
+		return packBits(data)
+	case compressionLZW:
+		return lzw(data)
+	case compressionDeflate:
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		return b.Bytes()
+	}
+	return data
+}
+
+// packBits compresses runs of three or more bytes, and stores the rest as literals
+func packBits(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && run < 128 && data[i+run] == data[i] {
+			run++
+		}
+		if run >= 3 {
+			out = append(out, byte(int8(1-run)), data[i])
+			i += run
+			continue
+		}
+		start := i
+		for i < len(data) && i-start < 128 && !(i+2 < len(data) && data[i] == data[i+1] && data[i] == data[i+2]) {
+			i++
+		}
+		out = append(out, byte(i-start-1))
+		out = append(out, data[start:i]...)
+	}
+	return out
+}
+
+// lzw compresses data with TIFF's LZW, where the codes get wider one code early
+func lzw(data []byte) []byte {
+	var out []byte
+	var acc uint32
+	var nbits int
+	width := 9
+	emit := func(code int) {
+		acc = acc<<width | uint32(code)
+		nbits += width
+		for nbits >= 8 {
+			out = append(out, byte(acc>>(nbits-8)))
+			nbits -= 8
+		}
+	}
+	var table map[string]int
+	var next int
+	reset := func() {
+		table = map[string]int{}
+		for i := 0; i < 256; i++ {
+			table[string([]byte{byte(i)})] = i
+		}
+		next = lzwEnd + 1
+		width = 9
+	}
+	reset()
+	emit(lzwClear)
+	var prefix string
+	for _, c := range data {
+		s := prefix + string([]byte{c})
+		if _, ok := table[s]; ok {
+			prefix = s
+			continue
+		}
+		emit(table[prefix])
+		table[s] = next
+		next++
+		if next >= 1<<width {
+			width++
+		}
+		if next >= 4094 {
+			emit(lzwClear)
+			reset()
+		}
+		prefix = string([]byte{c})
+	}
+	if prefix != "" {
+		emit(table[prefix])
+		// the decoder adds an entry for the last code too
+		next++
+		if next >= 1<<width && width < 12 {
+			width++
+		}
+	}
+	emit(lzwEnd)
+	if nbits > 0 {
+		out = append(out, byte(acc<<(8-nbits)))
+	}
+	return out
+}
+
+// pattern returns samples with a mix of values up to max for a width by height image
+func pattern(width, height int, max uint32) []uint32 {
+	var s []uint32
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			s = append(s, uint32(x*4099+y*3343+x*y*7)%(max+1))
+		}
+	}
+	return s
+}
+
+// greys returns the 16-bit greys of an image, in reading order
+func greys(m image.Image) []uint32 {
+	var g []uint32
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g = append(g, uint32(color.Gray16Model.Convert(m.At(x, y)).(color.Gray16).Y))
+		}
+	}
+	return g
+}
+
+// sameGreys fails the test unless m is width by height, with the color model for its
+// number of bits, and 8 or 16-bit greys that match want
+func sameGreys(t *testing.T, m image.Image, width, height, bits int, want []uint32) {
+	t.Helper()
+	if m.Bounds() != image.Rect(0, 0, width, height) {
+		t.Fatalf("bounds are %v, want %dx%d", m.Bounds(), width, height)
+	}
+	model, scale := color.GrayModel, uint32(0x101)
+	if bits > 8 {
+		model, scale = color.Gray16Model, 1
+	}
+	if m.ColorModel() != model {
+		t.Fatalf("image is a %T, want %v bits", m, bits)
+	}
+	got := greys(m)
+	for i := range want {
+		if got[i] != want[i]*scale {
+			t.Fatalf("pixel %d,%d is %d, want %d", i%width, i/width, got[i], want[i]*scale)
+		}
+	}
+}
+
+func TestDecodeLayouts(t *testing.T) {
+	compressions := []struct {
+		name string
+		code int
+	}{
+		{"none", compressionNone},
+		{"PackBits", compressionPackBits},
+		{"LZW", compressionLZW},
+		{"Deflate", compressionDeflate},
+	}
+	layouts := []struct {
+		name string
+		page testPage
+	}{
+		{"one strip", testPage{}},
+		{"strips", testPage{rowsPerStrip: 5}},
+		{"tiles", testPage{tile: 16}},
+	}
+	orders := []byteOrder{binary.LittleEndian, binary.BigEndian}
+
+	const width, height = 20, 18
+	for _, c := range compressions {
+		for _, l := range layouts {
+			for _, bits := range []int{8, 16} {
+				for _, predictor := range []int{1, 2} {
+					for _, minIsWhite := range []bool{false, true} {
+						for _, order := range orders {
+							max := uint32(1)<<bits - 1
+							p := l.page
+							p.width, p.height, p.bits = width, height, bits
+							p.compression, p.predictor, p.minIsWhite = c.code, predictor, minIsWhite
+							p.samples = pattern(width, height, max)
+							name := fmt.Sprintf("%s/%s/%d-bit/predictor %d/%v", c.name, l.name, bits, predictor, order)
+							if minIsWhite {
+								name += "/MinIsWhite"
+							}
+							t.Run(name, func(t *testing.T) {
+								m, err := Decode(bytes.NewReader(tiffFile(order, p)))
+								if err != nil {
+									t.Fatal(err)
+								}
+								want := slices.Clone(p.samples)
+								if minIsWhite {
+									for i := range want {
+										want[i] = max - want[i]
+									}
+								}
+								sameGreys(t, m, width, height, bits, want)
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeSamples(t *testing.T) {
+	nan := math.Float32bits(float32(math.NaN()))
+	f := func(v float32) uint32 { return math.Float32bits(v) }
+	tests := []struct {
+		name string
+		page testPage
+		want []uint32 // 8-bit greys, or 16-bit for more than 8 bits
+	}{
+		{"1-bit", testPage{width: 10, height: 2, bits: 1, samples: pattern(10, 2, 1)}, scaled(pattern(10, 2, 1), 255)},
+		{
+			"1-bit MinIsWhite",
+			testPage{width: 10, height: 1, bits: 1, minIsWhite: true, samples: []uint32{1, 0, 0, 1, 1, 1, 0, 0, 0, 1}},
+			[]uint32{0, 255, 255, 0, 0, 0, 255, 255, 255, 0},
+		},
+		{"2-bit", testPage{width: 5, height: 2, bits: 2, samples: pattern(5, 2, 3)}, scaled(pattern(5, 2, 3), 85)},
+		{"4-bit", testPage{width: 5, height: 3, bits: 4, samples: pattern(5, 3, 15)}, scaled(pattern(5, 3, 15), 17)},
+		{
+			"4-bit LZW",
+			testPage{width: 5, height: 3, bits: 4, compression: compressionLZW, samples: pattern(5, 3, 15)},
+			scaled(pattern(5, 3, 15), 17),
+		},
+		{
+			"signed 8-bit",
+			testPage{width: 4, height: 1, bits: 8, format: sampleSigned, samples: []uint32{0x80, 0xff, 0, 0x7f}},
+			[]uint32{0, 127, 128, 255},
+		},
+		{
+			"signed 16-bit",
+			testPage{width: 3, height: 1, bits: 16, format: sampleSigned, samples: []uint32{0x8000, 0, 0x7fff}},
+			[]uint32{0, 0x8000, 0xffff},
+		},
+		{
+			"signed 32-bit",
+			testPage{width: 3, height: 1, bits: 32, format: sampleSigned, samples: []uint32{0x80000000, 0, 0x7fffffff}},
+			[]uint32{0, 0x8000, 0xffff},
+		},
+		{
+			"unsigned 32-bit",
+			testPage{width: 3, height: 1, bits: 32, samples: []uint32{0, 0x12345678, 0xffffffff}},
+			[]uint32{0, 0x1234, 0xffff},
+		},
+		{
+			"unsigned 32-bit predictor",
+			testPage{width: 3, height: 1, bits: 32, predictor: 2, compression: compressionLZW, samples: []uint32{5 << 16, 0x12345678, 0xffffffff}},
+			[]uint32{5, 0x1234, 0xffff},
+		},
+		{
+			// floats are clipped to 0-1, and NaN is black
+			"float",
+			testPage{width: 5, height: 1, bits: 32, format: sampleFloat, samples: []uint32{f(0), f(0.5), f(1), f(-1), f(2)}},
+			[]uint32{0, 0x8000, 0xffff, 0, 0xffff},
+		},
+		{"float NaN", testPage{width: 1, height: 1, bits: 32, format: sampleFloat, samples: []uint32{nan}}, []uint32{0}},
+		{
+			// LZW with enough codes to fill the table, which has to be cleared
+			"LZW table clear",
+			testPage{width: 128, height: 64, bits: 16, compression: compressionLZW, rowsPerStrip: 64, samples: pattern(128, 64, 0xffff)},
+			pattern(128, 64, 0xffff),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+				data := tiffFile(order, tc.page)
+				m, err := Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				sameGreys(t, m, tc.page.width, tc.page.height, tc.page.bits, tc.want)
+
+				cfg, err := DecodeConfig(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cfg.Width != tc.page.width || cfg.Height != tc.page.height || cfg.ColorModel != m.ColorModel() {
+					t.Errorf("config is %dx%d %v, want %dx%d %v", cfg.Width, cfg.Height, cfg.ColorModel, tc.page.width, tc.page.height, m.ColorModel())
+				}
+			}
+		})
+	}
+}
+
+// scaled multiplies each sample by n
+func scaled(samples []uint32, n uint32) []uint32 {
+	var s []uint32
+	for _, v := range samples {
+		s = append(s, v*n)
+	}
+	return s
+}
+
+func TestDecodePages(t *testing.T) {
+	pages := []testPage{
+		{width: 4, height: 3, bits: 8, samples: pattern(4, 3, 0xff)},
+		// an uncompressed page with a predictor is undone in a copy of the data, so it can be read twice
+		{width: 5, height: 2, bits: 16, predictor: 2, samples: pattern(5, 2, 0xffff)},
+		{width: 3, height: 3, bits: 4, compression: compressionPackBits, samples: pattern(3, 3, 15)},
+	}
+	want := [][]uint32{pages[0].samples, pages[1].samples, scaled(pages[2].samples, 17)}
+	data := tiffFile(binary.LittleEndian, pages...)
+
+	tests := []struct {
+		name  string
+		pages []int
+		err   string
+	}{
+		{"all", nil, ""},
+		{"first", []int{0}, ""},
+		{"backwards", []int{2, 1, 0}, ""},
+		{"twice", []int{1, 1}, ""},
+		{"too many", []int{3}, "there is no page 4, the file has 3 pages"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ms, n, err := DecodePages(bytes.NewReader(data), tc.pages)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("error is %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 3 {
+				t.Errorf("the file has %d pages, want 3", n)
+			}
+			indexes := tc.pages
+			if indexes == nil {
+				indexes = []int{0, 1, 2}
+			}
+			if len(ms) != len(indexes) {
+				t.Fatalf("got %d pages, want %d", len(ms), len(indexes))
+			}
+			for i, m := range ms {
+				p := pages[indexes[i]]
+				sameGreys(t, m, p.width, p.height, p.bits, want[indexes[i]])
+			}
+		})
+	}
+
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameGreys(t, m, 4, 3, 8, want[0])
+}
+
+func TestDecodeErrors(t *testing.T) {
+	good := testPage{width: 2, height: 2, bits: 8, samples: []uint32{1, 2, 3, 4}}
+	with := func(change func(p *testPage)) []byte {
+		p := good
+		change(&p)
+		return tiffFile(binary.LittleEndian, p)
+	}
+	loop := tiffFile(binary.LittleEndian, good)
+	// point the next directory offset back at the first directory
+	first := binary.LittleEndian.Uint32(loop[4:])
+	binary.LittleEndian.PutUint32(loop[len(loop)-4:], first)
+	short := tiffFile(binary.LittleEndian, good)
+	binary.LittleEndian.PutUint32(short[first+2+12*6+8:], 1000)
+	// a width and height whose product overflows
+	huge := tiffFile(binary.LittleEndian, good)
+	binary.LittleEndian.PutUint32(huge[first+2+8:], 0xffffffff)
+	binary.LittleEndian.PutUint32(huge[first+2+12+8:], 0xffffffff)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not TIFF", []byte("GIF89a and more"), "not a TIFF"},
+		{"BigTIFF", []byte("II+\x00\x08\x00\x00\x00"), "BigTIFF"},
+		{"RGB", with(func(p *testPage) { p.spp = 3 }), "3 samples per pixel"},
+		{"JPEG", with(func(p *testPage) { p.compression = 7 }), "compression 7"},
+		{"12-bit", with(func(p *testPage) { p.bits = 12 }), "12-bit"},
+		{"4-bit predictor", with(func(p *testPage) { p.bits, p.predictor = 4, 2 }), "predictor 2"},
+		{"huge", huge, "bad size 4294967295x4294967295"},
+		{"loop", loop, "loop"},
+		{"strip past the end", short, "past the end"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("error is %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}